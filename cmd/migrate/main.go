@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	c "github.com/EwvwGeN/medods_assignment/internal/config"
+	l "github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+)
+
+var (
+	configPath string
+	driver     string
+	timeout    time.Duration
+)
+
+func init() {
+	flag.StringVar(&configPath, "config", "", "path to config file")
+	flag.StringVar(&driver, "driver", "", "storage to migrate, storage.driver from config by default")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "timeout of the whole migration")
+}
+
+func main() {
+	flag.Parse()
+	cfg, err := c.LoadConfig(configPath)
+	if err != nil {
+		panic(fmt.Sprintf("cant load config from path %s: %s", configPath, err.Error()))
+	}
+
+	logger := l.SetupLogger(cfg.LogLevel)
+
+	if driver == "" {
+		driver = cfg.StorageConfig.Driver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var applied []int
+	switch driver {
+	case "mongo", "":
+		applied, err = storage.MigrateMongo(ctx, cfg.MongoConfig)
+	case "postgres":
+		applied, err = storage.MigratePostgres(ctx, cfg.PostgresConfig)
+	default:
+		logger.Error("storage has no migrations", slog.String("driver", driver))
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Error("migration failed", slog.String("driver", driver), slog.Any("applied", applied), slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	logger.Info("migration finished", slog.String("driver", driver), slog.Any("applied", applied))
+}
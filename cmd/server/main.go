@@ -4,17 +4,24 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/EwvwGeN/medods_assignment/internal/app"
 	c "github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/hasher"
 	"github.com/EwvwGeN/medods_assignment/internal/jwt"
+	"github.com/EwvwGeN/medods_assignment/internal/http/middleware"
 	l "github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/metrics"
+	"github.com/EwvwGeN/medods_assignment/internal/ratelimit"
 	"github.com/EwvwGeN/medods_assignment/internal/service"
 	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
 )
 
 var (
@@ -38,22 +45,159 @@ func main() {
 	
 	mainCtx, cancel := context.WithCancel(context.Background())
 
-	jwtManager := jwt.NewJwtManager(cfg.JwtSecret)
+	var shutdownTracing func(context.Context) error
+	if cfg.TracingConfig.Enabled {
+		shutdownTracing, err = tracing.Setup(mainCtx, cfg.TracingConfig)
+		if err != nil {
+			panic(fmt.Sprintf("cant setup tracing: %s", err.Error()))
+		}
+	}
+
+	jwtManager, err := jwt.NewJwtManagerFromConfig(cfg.JwtConfig, cfg.JwtSecret)
+	if err != nil {
+		panic(fmt.Sprintf("cant create jwt manager: %s", err.Error()))
+	}
+	if cfg.JwtConfig.RotationInterval > 0 {
+		if jwtManager.Algorithm() == jwt.AlgorithmHS512 {
+			panic(fmt.Sprintf("jwt rotation interval is set, but %s keys cant be rotated: the shared secret is known to verifiers, set jwt.algorithm to an asymmetric one", jwt.AlgorithmHS512))
+		}
+		if cfg.JwtConfig.RotationInterval < jwt.JWKSMaxAge {
+			panic(fmt.Sprintf("jwt rotation interval cant be less than jwks cache lifetime %s", jwt.JWKSMaxAge))
+		}
+		go jwtManager.RunRotation(mainCtx, logger, cfg.JwtConfig.RotationInterval, max(cfg.TokenTTL, cfg.OidcConfig.IdTokenTTL))
+	}
+
+	var userRepo service.UserRepo
+	var storageDenylist service.TokenDenylist
+	var backuper app.Backuper
+	// storageCloser is closed after the server stopped serving requests
+	var storageCloser io.Closer
+	var storageRateStore ratelimit.Store
+	switch cfg.StorageConfig.Driver {
+	case "memory":
+		logger.Warn("using in-memory storage, data will be lost on restart")
+		userRepo = storage.NewMemoryProvider(mainCtx, cfg.StorageConfig.CleanupInterval)
+		storageDenylist = storage.NewMemoryDenylist(mainCtx, cfg.DenylistConfig.CleanupInterval)
+	case "mongo", "":
+		mongoDB, err := storage.NewMongoProvider(mainCtx, cfg.MongoConfig)
+		if err != nil {
+			panic("cant get mongo provider")
+		}
+		userRepo = mongoDB
+		storageDenylist = mongoDB
+		storageRateStore = mongoDB
+	case "postgres":
+		postgresDB, err := storage.NewPostgresProvider(mainCtx, cfg.PostgresConfig)
+		if err != nil {
+			panic(fmt.Sprintf("cant get postgres provider: %s", err.Error()))
+		}
+		userRepo = postgresDB
+		storageDenylist = postgresDB
+	case "bolt":
+		boltDB, err := storage.NewBoltProvider(mainCtx, cfg.BoltConfig)
+		if err != nil {
+			panic(fmt.Sprintf("cant open bolt storage: %s", err.Error()))
+		}
+		userRepo = boltDB
+		storageDenylist = boltDB
+		backuper = boltDB
+		storageCloser = boltDB
+	default:
+		panic(fmt.Sprintf("unknown storage driver: %s", cfg.StorageConfig.Driver))
+	}
+
+	var denylist service.TokenDenylist
+	switch cfg.DenylistConfig.Driver {
+	case "memory":
+		denylist = storage.NewMemoryDenylist(mainCtx, cfg.DenylistConfig.CleanupInterval)
+	case "storage", "":
+		denylist = storageDenylist
+	case "mongo":
+		if cfg.StorageConfig.Driver != "mongo" && cfg.StorageConfig.Driver != "" {
+			panic("mongo denylist requires mongo storage")
+		}
+		denylist = storageDenylist
+	default:
+		panic(fmt.Sprintf("unknown denylist driver: %s", cfg.DenylistConfig.Driver))
+	}
+
+	var limiter app.RateLimiter
+	if cfg.RateLimitConfig.Enabled {
+		var rateStore ratelimit.Store
+		switch cfg.RateLimitConfig.Driver {
+		case "memory":
+			rateStore = storage.NewMemoryRateLimiter(mainCtx, cfg.RateLimitConfig.CleanupInterval)
+		case "storage", "":
+			rateStore = storageRateStore
+			if rateStore == nil {
+				logger.Warn("storage cant keep rate limit buckets, they are kept in memory of every instance")
+				rateStore = storage.NewMemoryRateLimiter(mainCtx, cfg.RateLimitConfig.CleanupInterval)
+			}
+		case "mongo":
+			if cfg.StorageConfig.Driver != "mongo" && cfg.StorageConfig.Driver != "" {
+				panic("mongo rate limit requires mongo storage")
+			}
+			rateStore = storageRateStore
+		default:
+			panic(fmt.Sprintf("unknown rate limit driver: %s", cfg.RateLimitConfig.Driver))
+		}
+		limiter = ratelimit.NewLimiter(rateStore)
+	}
 
-	mongoDB, err := storage.NewMongoProvider(mainCtx, cfg.MongoConfig)
+	var secretHasher service.Hasher
+	secretHasher, err = hasher.NewHasher(cfg.HasherConfig)
 	if err != nil {
-		panic("cant get mongo provider")
+		panic(fmt.Sprintf("cant create hasher: %s", err.Error()))
+	}
+
+	refreshSecret := cfg.RefreshSecret
+	if refreshSecret == "" {
+		refreshSecret = cfg.JwtSecret
+	}
+	if refreshSecret == "" {
+		panic("refresh secret cant be empty")
+	}
+	refreshDigester := hasher.NewDigester(refreshSecret)
+
+	var requestObserver middleware.RequestObserver
+	var authMetrics *metrics.Metrics
+	if cfg.MetricsConfig.Enabled {
+		authMetrics = metrics.New()
+		userRepo = authMetrics.InstrumentRepo(userRepo)
+		denylist = authMetrics.InstrumentDenylist(denylist)
+		secretHasher = authMetrics.InstrumentHasher(secretHasher)
+		requestObserver = authMetrics
+		authMetrics.RunServer(mainCtx, cfg.MetricsConfig, logger)
 	}
 
-	auth := service.NewAuth(mainCtx, logger, mongoDB, jwtManager, cfg.TokenTTL, cfg.RefreshTTL)
+	var auth app.Auth = service.NewAuth(mainCtx, logger, userRepo, jwtManager, denylist, secretHasher, refreshDigester, cfg.TokenTTL, cfg.RefreshTTL, cfg.OidcConfig, cfg.TimeoutsConfig, cfg.LockoutConfig)
+	if authMetrics != nil {
+		auth = authMetrics.InstrumentAuth(auth)
+	}
 
-	app := app.ServerNewInstance(mainCtx, *cfg, logger, auth)
-	app.RunServer(mainCtx)
+	app := app.ServerNewInstance(mainCtx, *cfg, logger, auth, backuper, limiter, requestObserver)
+	errCloseCh := app.RunServer(mainCtx)
 
 	stopChecker := make(chan os.Signal, 1)
 	signal.Notify(stopChecker, syscall.SIGTERM, syscall.SIGINT)
 	<- stopChecker
 	logger.Info("start stopping service")
 	cancel()
+	if err := <-errCloseCh; err != nil {
+		logger.Warn("failed to shutdown server", slog.String("error", err.Error()))
+	}
+	if storageCloser != nil {
+		if err := storageCloser.Close(); err != nil {
+			logger.Warn("failed to close storage", slog.String("error", err.Error()))
+		}
+	}
+	if shutdownTracing != nil {
+		// spans buffered by the batcher are sent before exit
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Warn("failed to flush traces", slog.String("error", err.Error()))
+		}
+		cancelShutdown()
+	}
 	logger.Info("service stopped")
 }
\ No newline at end of file
@@ -1,39 +1,42 @@
 package app
 
 import (
+	"crypto/subtle"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
-	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/jwt"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/validator"
 	"github.com/gorilla/mux"
 )
 
 func (s *server) RegisterUser() http.HandlerFunc {
-	log := s.log.With(slog.String("handler", "register_user"))
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "register_user"))
+		if !s.allowIP(w, r, log, "register", s.cfg.RateLimitConfig.Register) {
+			return
+		}
 		req := models.RegisterRequest{}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Error("cant decode request body")
-			http.Error(w, "error while decoidng response object", http.StatusBadRequest)
+		if !s.decodeJSON(w, r, log, &req) {
 			return
 		}
-		if req.Email == "" {
-			log.Info("empty email in request")
-			http.Error(w, "email cant be empty", http.StatusBadRequest)
+		if err := req.Validate(); err != nil {
+			writeError(w, r, log, "invalid request", err)
 			return
 		}
-		uuid, err := s.auth.RegisterUser(req.Email)
+		if !s.allowKey(w, r, log, "register", s.cfg.RateLimitConfig.Register, req.Email) {
+			return
+		}
+		uuid, err := s.auth.RegisterUser(r.Context(), req.Email, req.Password)
 		if err != nil {
-			if errors.Is(err, storage.ErrUserExist) {
-				log.Info("error while registration", slog.String("email", req.Email), slog.String("error", storage.ErrUserExist.Error()))
-				http.Error(w, "error while registration: user exist", http.StatusBadRequest)
-				return
-			}
-			log.Warn("error while registration", slog.String("email", req.Email), slog.String("error", err.Error()))
-			http.Error(w, "error while registration", http.StatusInternalServerError)
+			writeError(w, r, log, "error while registration", err, slog.String("email", req.Email))
 			return
 		}
 		res := &models.RegisterResponse{
@@ -42,7 +45,41 @@ func (s *server) RegisterUser() http.HandlerFunc {
 		jsonRes, err := json.Marshal(&res)
 		if err != nil {
 			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
-			http.Error(w, "error while registration", http.StatusInternalServerError)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonRes)
+	}
+}
+
+func (s *server) Login() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "login"))
+		if !s.allowIP(w, r, log, "login", s.cfg.RateLimitConfig.Login) {
+			return
+		}
+		req := models.LoginRequest{}
+		if !s.decodeJSON(w, r, log, &req) {
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeError(w, r, log, "invalid request", err)
+			return
+		}
+		if !s.allowKey(w, r, log, "login", s.cfg.RateLimitConfig.Login, req.Email) {
+			return
+		}
+		res, err := s.auth.Login(r.Context(), req.Email, req.Password, deviceLabel(r, req.Device), req.Nonce)
+		if err != nil {
+			writeError(w, r, log, "cant login", err, slog.String("email", req.Email))
+			return
+		}
+		jsonRes, err := json.Marshal(res)
+		if err != nil {
+			log.Error("cant marshal response", slog.String("error", err.Error()))
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
 			return
 		}
 		w.Header().Add("Content-Type", "application/json")
@@ -52,30 +89,39 @@ func (s *server) RegisterUser() http.HandlerFunc {
 }
 
 func (s *server) CreateTokenPair() http.HandlerFunc {
-	log := s.log.With(slog.String("handler", "create_token_pair"))
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "create_token_pair"))
+		if !s.allowIP(w, r, log, "create_token_pair", s.cfg.RateLimitConfig.CreateTokenPair) {
+			return
+		}
 		vars := mux.Vars(r)
 		uuid, ok := vars["uuid"]
 		if !ok {
 			log.Warn("cant get uuid from params", slog.Any("vars", vars))
-			http.Error(w, "cant get uuid", http.StatusBadRequest)
+			problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "cant get uuid"))
 			return
 		}
 		log.Debug("got uuid", slog.String("uuid", uuid))
-		token, refresh, err := s.auth.CreateTokenPair(uuid)
-		if err != nil {
-			log.Info("cant create token pair", slog.String("uuid", uuid), slog.String("error", err.Error()))
-			http.Error(w, "cant create token pair", http.StatusInternalServerError)
+		device, nonce := r.URL.Query().Get("device"), r.URL.Query().Get("nonce")
+		v := validator.Validator{}
+		v.MaxLength("device", device, models.MaxDeviceLength)
+		v.MaxLength("nonce", nonce, models.MaxNonceLength)
+		if err := v.Err(); err != nil {
+			writeError(w, r, log, "invalid request", err)
 			return
 		}
-		res := &models.TokenPair{
-			AccessToken: token,
-			RefreshToken: refresh,
+		if !s.allowKey(w, r, log, "create_token_pair", s.cfg.RateLimitConfig.CreateTokenPair, uuid) {
+			return
 		}
-		jsonRes, err := json.Marshal(&res)
+		res, err := s.auth.CreateTokenPair(r.Context(), uuid, deviceLabel(r, device), nonce)
+		if err != nil {
+			writeError(w, r, log, "cant create token pair", err, slog.String("uuid", uuid))
+			return
+		}
+		jsonRes, err := json.Marshal(res)
 		if err != nil {
 			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
-			http.Error(w, "error while creating token pair", http.StatusInternalServerError)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
 			return
 		}
 		w.Header().Add("Content-Type", "application/json")
@@ -85,28 +131,26 @@ func (s *server) CreateTokenPair() http.HandlerFunc {
 }
 
 func (s *server) RefrashToken() http.HandlerFunc {
-	log := s.log.With(slog.String("handler", "refresh_token"))
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "refresh_token"))
+		if !s.allowIP(w, r, log, "refresh", s.cfg.RateLimitConfig.Refresh) {
+			return
+		}
 		req := models.RefreshRequest{}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Error("cant decode request body")
-			http.Error(w, "error while decoidng response object", http.StatusBadRequest)
+		if !s.decodeJSON(w, r, log, &req) {
 			return
 		}
-		if req.TokenPair.RefreshToken == "" {
-			log.Info("empty refresh token in request")
-			http.Error(w, "refresh token cant be empty", http.StatusBadRequest)
+		if err := req.Validate(); err != nil {
+			writeError(w, r, log, "invalid request", err)
 			return
 		}
-		if req.TokenPair.AccessToken == "" {
-			log.Info("empty access token in request")
-			http.Error(w, "access token cant be empty", http.StatusBadRequest)
+		owner := s.refreshOwner(r, log, req.TokenPair.RefreshToken)
+		if !s.allowKey(w, r, log, "refresh", s.cfg.RateLimitConfig.Refresh, owner) {
 			return
 		}
-		token, refresh, err := s.auth.RefreshToken(req.TokenPair.AccessToken, req.TokenPair.RefreshToken)
+		token, refresh, err := s.auth.RefreshToken(r.Context(), req.TokenPair.AccessToken, req.TokenPair.RefreshToken)
 		if err != nil {
-			log.Info("cant refresh token", slog.String("error", err.Error()))
-			http.Error(w, "cant refresh token", http.StatusInternalServerError)
+			writeError(w, r, log, "cant refresh token", err)
 			return
 		}
 		res := &models.RefreshResponse{
@@ -117,11 +161,219 @@ func (s *server) RefrashToken() http.HandlerFunc {
 		jsonRes, err := json.Marshal(&res)
 		if err != nil {
 			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
-			http.Error(w, "error refreshing token", http.StatusInternalServerError)
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
 			return
 		}
 		w.Header().Add("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		w.Write(jsonRes)
 	}
-}
\ No newline at end of file
+}
+
+func (s *server) RevokeToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "revoke_token"))
+		clientId, ok := s.requireClient(w, r, log, "revocation")
+		if !ok {
+			return
+		}
+		if !s.parseForm(w, r, log) {
+			return
+		}
+		token := r.PostForm.Get("token")
+		if err := validateTokenForm(token); err != nil {
+			writeError(w, r, log, "invalid request", err)
+			return
+		}
+		err := s.auth.RevokeToken(r.Context(), token, r.PostForm.Get("token_type_hint"))
+		if err != nil {
+			writeError(w, r, log, "cant revoke token", err, slog.String("client_id", clientId))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *server) LogoutAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "logout_all"))
+		token, ok := bearerToken(r)
+		if !ok {
+			log.Info("empty access token in request")
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "access token cant be empty"))
+			return
+		}
+		err := s.auth.LogoutAll(r.Context(), token)
+		if err != nil {
+			writeError(w, r, log, "cant logout", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deviceLabel returns device passed by the client or its truncated user agent.
+func deviceLabel(r *http.Request, device string) string {
+	if device != "" {
+		return device
+	}
+	device = r.UserAgent()
+	if len(device) > models.MaxDeviceLength {
+		device = strings.ToValidUTF8(device[:models.MaxDeviceLength], "")
+	}
+	return device
+}
+
+func validateTokenForm(token string) error {
+	v := validator.Validator{}
+	if v.Required("token", token) {
+		v.MaxLength("token", token, models.MaxTokenLength)
+	}
+	return v.Err()
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func (s *server) IntrospectToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "introspect_token"))
+		clientId, ok := s.requireClient(w, r, log, "introspection")
+		if !ok {
+			return
+		}
+		if !s.parseForm(w, r, log) {
+			return
+		}
+		token := r.PostForm.Get("token")
+		if err := validateTokenForm(token); err != nil {
+			writeError(w, r, log, "invalid request", err)
+			return
+		}
+		res, err := s.auth.IntrospectToken(r.Context(), token, r.PostForm.Get("token_type_hint"))
+		if err != nil {
+			writeError(w, r, log, "cant introspect token", err, slog.String("client_id", clientId))
+			return
+		}
+		jsonRes, err := json.Marshal(res)
+		if err != nil {
+			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	}
+}
+
+// requireClient authenticates the client and writes 401 with the basic auth
+// challenge for realm when the credentials are missing or wrong.
+func (s *server) requireClient(w http.ResponseWriter, r *http.Request, log *slog.Logger, realm string) (clientId string, ok bool) {
+	clientId, ok = s.authenticateClient(r)
+	if !ok {
+		log.Info("client authentication failed", slog.String("client_id", clientId))
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, problem.CodeInvalidClient, "client authentication failed"))
+	}
+	return clientId, ok
+}
+
+// authenticateClient checks client credentials passed with basic auth
+// against clients from the introspection config, they are used for revocation too.
+func (s *server) authenticateClient(r *http.Request) (clientId string, ok bool) {
+	clientId, secret, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	expected, exist := s.cfg.IntrospectionConfig.Clients[clientId]
+	return clientId, exist && subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+func (s *server) JWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "jwks"))
+		res := s.auth.JWKS()
+		jsonRes, err := json.Marshal(&res)
+		if err != nil {
+			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwt.JWKSMaxAge.Seconds())))
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	}
+}
+
+func (s *server) Metadata() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "metadata"))
+		res := s.auth.Metadata()
+		jsonRes, err := json.Marshal(&res)
+		if err != nil {
+			log.Error("cant marshal response", slog.Any("response", res), slog.String("error", err.Error()))
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonRes)
+	}
+}
+
+// Backup streams copy of the storage file. Write timeout of the server
+// is disabled for this response, because the file can be large.
+func (s *server) Backup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "backup"))
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn("cant disable write deadline", slog.String("error", err.Error()))
+		}
+		w.Header().Add("Content-Type", "application/octet-stream")
+		w.Header().Add("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="backup-%s.db"`, time.Now().UTC().Format("20060102T150405Z")))
+		n, err := s.backuper.Backup(r.Context(), w)
+		if err != nil {
+			// headers are already sent, so the client sees only broken body
+			log.Error("cant write backup", slog.Int64("written", n), slog.String("error", err.Error()))
+			return
+		}
+		log.Info("backup written", slog.Int64("size", n))
+	}
+}
+
+// UnlockUser removes lockout of the user caused by failed attempts.
+func (s *server) UnlockUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "unlock_user"))
+		uuid := mux.Vars(r)["uuid"]
+		if err := s.auth.UnlockUser(r.Context(), uuid); err != nil {
+			writeError(w, r, log, "cant unlock user", err, slog.String("uuid", uuid))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// adminOnly allows only requests with the admin token from config.
+func (s *server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context(), s.log).With(slog.String("handler", "admin_only"))
+		token, ok := bearerToken(r)
+		if !ok || s.cfg.AdminConfig.Token == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminConfig.Token)) != 1 {
+			log.Warn("unauthorized admin request", slog.String("path", r.URL.Path))
+			problem.Write(w, r, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "admin token doesnt valid"))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/validator"
+)
+
+// errorProblems maps sentinel errors to responses, the first matching one is used.
+var errorProblems = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrPasswordPolicy, http.StatusUnprocessableEntity, problem.CodeValidation},
+	{service.ErrInvalidCredentials, http.StatusUnauthorized, problem.CodeInvalidCredentials},
+	{service.ErrValidAccess, http.StatusUnauthorized, problem.CodeInvalidToken},
+	{service.ErrValidRefresh, http.StatusUnauthorized, problem.CodeInvalidToken},
+	{service.ErrRefreshReused, http.StatusUnauthorized, problem.CodeRefreshReused},
+	{service.ErrRefreshConflict, http.StatusConflict, problem.CodeRefreshConflict},
+	{service.ErrAccountLocked, http.StatusLocked, problem.CodeAccountLocked},
+	{storage.ErrUserExist, http.StatusConflict, problem.CodeUserExists},
+	{storage.ErrUserNotFound, http.StatusNotFound, problem.CodeUserNotFound},
+	{storage.ErrSessionNotFound, http.StatusNotFound, problem.CodeSessionNotFound},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, problem.CodeTimeout},
+	{service.ErrGetUserUUID, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrGetUserEmail, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrSaveUser, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrGetSession, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrRevokeSession, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrRevokeAccess, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrCheckDenylist, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{service.ErrUnlockUser, http.StatusServiceUnavailable, problem.CodeUnavailable},
+	{storage.ErrUpdate, http.StatusServiceUnavailable, problem.CodeUnavailable},
+}
+
+// problemFromError returns problem for the error returned by auth.
+// Details of unknown errors are not exposed to clients.
+func problemFromError(err error) *problem.Problem {
+	var fieldErrs validator.Errors
+	if errors.As(err, &fieldErrs) {
+		p := problem.New(http.StatusUnprocessableEntity, problem.CodeValidation, "request fields are invalid")
+		for _, fieldErr := range fieldErrs {
+			p.Errors = append(p.Errors, problem.FieldError{
+				Field: fieldErr.Field,
+				Message: fieldErr.Message,
+			})
+		}
+		return p
+	}
+	for _, mapped := range errorProblems {
+		if errors.Is(err, mapped.err) {
+			detail := mapped.err.Error()
+			if mapped.status >= http.StatusInternalServerError {
+				detail = ""
+			}
+			return problem.New(mapped.status, mapped.code, detail)
+		}
+	}
+	return problem.New(http.StatusInternalServerError, problem.CodeInternal, "")
+}
+
+// writeError responds with the problem for err. Client errors are logged
+// with info level and server ones with warn.
+func writeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string, err error, attrs ...any) {
+	p := problemFromError(err)
+	attrs = append(attrs, slog.String("error", err.Error()), slog.String("code", p.Code))
+	if p.Status >= http.StatusInternalServerError {
+		log.Warn(msg, attrs...)
+	} else {
+		log.Info(msg, attrs...)
+	}
+	problem.Write(w, r, p)
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/stretchr/testify/suite"
+)
+
+type problemsSuite struct {
+	suite.Suite
+}
+
+func TestProblemsSuiteRun(t *testing.T) {
+	suite.Run(t, new(problemsSuite))
+}
+
+func (suite *problemsSuite) Test_ProblemFromError(){
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("failed refresh token: %w", service.ErrValidRefresh), http.StatusUnauthorized, problem.CodeInvalidToken},
+		{fmt.Errorf("failed refresh token: %w", service.ErrRefreshConflict), http.StatusConflict, problem.CodeRefreshConflict},
+		{fmt.Errorf("failed register user: %w", storage.ErrUserExist), http.StatusConflict, problem.CodeUserExists},
+		{fmt.Errorf("failed create token pair: %w", storage.ErrUserNotFound), http.StatusNotFound, problem.CodeUserNotFound},
+		{fmt.Errorf("failed register user: %w", service.ErrPasswordPolicy), http.StatusUnprocessableEntity, problem.CodeValidation},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, problem.CodeTimeout},
+		{fmt.Errorf("failed login: %w: %w", service.ErrGetUserEmail, context.DeadlineExceeded), http.StatusGatewayTimeout, problem.CodeTimeout},
+		{fmt.Errorf("failed login: %w", service.ErrGetUserEmail), http.StatusServiceUnavailable, problem.CodeUnavailable},
+		{errors.New("unexpected"), http.StatusInternalServerError, problem.CodeInternal},
+	}
+	for _, c := range cases {
+		p := problemFromError(c.err)
+		suite.Equal(c.status, p.Status, c.err.Error())
+		suite.Equal(c.code, p.Code, c.err.Error())
+	}
+	suite.Empty(problemFromError(errors.New("secret details")).Detail)
+}
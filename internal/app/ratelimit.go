@@ -0,0 +1,92 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/ratelimit"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+)
+
+// allowIP checks limit of the route for the client ip. It is called before
+// the body is read, so flooding clients do not make the server parse requests.
+// When the limit is exceeded 429 problem is written and false is returned.
+func (s *server) allowIP(w http.ResponseWriter, r *http.Request, log *slog.Logger, route string, limits config.RouteLimitConfig) bool {
+	return s.allow(w, r, log, route, ratelimit.Rule{
+		Key: route + ":ip:" + s.clientIP(r),
+		Limit: ratelimit.LimitFromConfig(limits.IP),
+	})
+}
+
+// allowKey checks limit of the route for the key taken from the request, empty key is not limited.
+func (s *server) allowKey(w http.ResponseWriter, r *http.Request, log *slog.Logger, route string, limits config.RouteLimitConfig, key string) bool {
+	if key == "" {
+		return true
+	}
+	return s.allow(w, r, log, route, ratelimit.Rule{
+		Key: route + ":key:" + key,
+		Limit: ratelimit.LimitFromConfig(limits.Key),
+	})
+}
+
+// allow writes 429 problem and returns false when the rule is exceeded.
+// Requests are allowed when the limiter store fails, so its outage does not stop logins.
+func (s *server) allow(w http.ResponseWriter, r *http.Request, log *slog.Logger, route string, rule ratelimit.Rule) bool {
+	if s.limiter == nil {
+		return true
+	}
+	retryAfter, allowed, err := s.limiter.Allow(r.Context(), rule)
+	if err != nil {
+		log.Warn("cant check rate limit, request is allowed", slog.String("error", err.Error()))
+		return true
+	}
+	if allowed {
+		return true
+	}
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	log.Info("rate limit exceeded", slog.String("route", route), slog.Int("retry_after", seconds))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	problem.Write(w, r, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited,
+		"too many requests, retry after "+strconv.Itoa(seconds)+" seconds"))
+	return false
+}
+
+// refreshOwner returns the key of refresh requests. Tokens are limited by their owner,
+// so guessing verifiers of one session is limited however many different tokens are sent.
+// Unknown tokens are limited only by ip. The owner is looked up only when the limit is enabled,
+// so refresh does not pay for an extra storage query otherwise.
+func (s *server) refreshOwner(r *http.Request, log *slog.Logger, refreshToken string) string {
+	if s.limiter == nil || !ratelimit.LimitFromConfig(s.cfg.RateLimitConfig.Refresh.Key).Enabled() {
+		return ""
+	}
+	owner, err := s.auth.RefreshTokenOwner(r.Context(), refreshToken)
+	if err != nil && !errors.Is(err, service.ErrValidRefresh) {
+		log.Warn("cant get owner of refresh token, only ip is limited", slog.String("error", err.Error()))
+	}
+	return owner
+}
+
+// clientIP returns the address appended to X-Forwarded-For by the farthest trusted proxy
+// or the address of the connection. Entries left of it are sent by the client and can be forged.
+func (s *server) clientIP(r *http.Request) string {
+	if proxies := s.cfg.RateLimitConfig.TrustedProxies; proxies > 0 {
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		if len(forwarded) >= proxies {
+			if ip := strings.TrimSpace(forwarded[len(forwarded)-proxies]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
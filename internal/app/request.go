@@ -0,0 +1,62 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+)
+
+const defaultMaxBodyBytes = 64 << 10
+
+// limitBody replaces body of the request with reader
+// failing after http.max_body_bytes are read.
+func (s *server) limitBody(w http.ResponseWriter, r *http.Request) {
+	limit := s.cfg.HttpConfig.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+}
+
+// decodeJSON decodes single json object from the body into dst rejecting
+// unknown fields. The problem is written when it returns false.
+func (s *server) decodeJSON(w http.ResponseWriter, r *http.Request, log *slog.Logger, dst any) bool {
+	s.limitBody(w, r)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain single json object")
+	}
+	if err != nil {
+		s.writeBodyProblem(w, r, log, err, "request body must be json object: ")
+		return false
+	}
+	return true
+}
+
+// parseForm parses url encoded body of the request.
+// The problem is written when it returns false.
+func (s *server) parseForm(w http.ResponseWriter, r *http.Request, log *slog.Logger) bool {
+	s.limitBody(w, r)
+	if err := r.ParseForm(); err != nil {
+		s.writeBodyProblem(w, r, log, err, "request body must be url encoded form: ")
+		return false
+	}
+	return true
+}
+
+func (s *server) writeBodyProblem(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error, detail string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		log.Info("request body is too large", slog.Int64("limit", maxBytesErr.Limit))
+		problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge, err.Error()))
+		return
+	}
+	log.Info("cant read request body", slog.String("error", err.Error()))
+	problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, detail+err.Error()))
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/ratelimit"
+	"github.com/stretchr/testify/suite"
+)
+
+// recordingLimiter keeps checked keys and denies keys with the denied prefix.
+type recordingLimiter struct {
+	keys   []string
+	denied string
+}
+
+func (l *recordingLimiter) Allow(ctx context.Context, rules ...ratelimit.Rule) (time.Duration, bool, error) {
+	for _, rule := range rules {
+		l.keys = append(l.keys, rule.Key)
+		if strings.HasPrefix(rule.Key, l.denied) {
+			return time.Second, false, nil
+		}
+	}
+	return 0, true, nil
+}
+
+// ownerAuth knows only the owner of refresh tokens and counts lookups, other methods are not used.
+type ownerAuth struct {
+	Auth
+	uuid    string
+	lookups int
+}
+
+func (a *ownerAuth) RefreshTokenOwner(ctx context.Context, refreshToken string) (string, error) {
+	a.lookups++
+	return a.uuid, nil
+}
+
+type requestSuite struct {
+	suite.Suite
+	server *server
+}
+
+func TestRequestSuiteRun(t *testing.T) {
+	suite.Run(t, new(requestSuite))
+}
+
+func (suite *requestSuite) SetupTest() {
+	suite.server = &server{
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg: config.Config{
+			HttpConfig: config.HttpConfig{
+				MaxBodyBytes: 64,
+			},
+		},
+	}
+}
+
+func (suite *requestSuite) decode(body string) (*httptest.ResponseRecorder, bool) {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(body))
+	req := models.RegisterRequest{}
+	return recorder, suite.server.decodeJSON(recorder, request, suite.server.log, &req)
+}
+
+func (suite *requestSuite) Test_DecodeJSON(){
+	_, ok := suite.decode(`{"email": "test@test.test", "password": "password"}`)
+	suite.True(ok)
+
+	cases := map[string]struct {
+		status int
+		code   string
+	}{
+		`{"email": "test@test.test", "admin": true}`: {http.StatusBadRequest, problem.CodeInvalidRequest},
+		`{"email": "test@test.test"} {}`: {http.StatusBadRequest, problem.CodeInvalidRequest},
+		`{"email": "`: {http.StatusBadRequest, problem.CodeInvalidRequest},
+		`{"email": "` + strings.Repeat("a", 64) + `"}`: {http.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge},
+	}
+	for body, expected := range cases {
+		recorder, ok := suite.decode(body)
+		suite.False(ok, body)
+		suite.Equal(expected.status, recorder.Code, body)
+		res := problem.Problem{}
+		suite.Require().NoError(json.Unmarshal(recorder.Body.Bytes(), &res))
+		suite.Equal(expected.code, res.Code, body)
+	}
+}
+
+func (suite *requestSuite) Test_ValidationProblem(){
+	req := models.RegisterRequest{Email: "not email"}
+	p := problemFromError(req.Validate())
+	suite.Equal(http.StatusUnprocessableEntity, p.Status)
+	suite.Equal([]problem.FieldError{
+		{Field: "email", Message: "must be valid email address"},
+		{Field: "password", Message: "must not be empty"},
+	}, p.Errors)
+}
+
+func (suite *requestSuite) Test_RevokeRequiresClient(){
+	suite.server.cfg.IntrospectionConfig.Clients = map[string]string{"test-client": "test-client-secret"}
+	for _, credentials := range [][2]string{{}, {"test-client", "wrong"}, {"unknown", "test-client-secret"}} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/revoke", strings.NewReader("token=abc"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if credentials[0] != "" {
+			request.SetBasicAuth(credentials[0], credentials[1])
+		}
+		suite.server.RevokeToken()(recorder, request)
+		suite.Equal(http.StatusUnauthorized, recorder.Code)
+		suite.Equal(`Basic realm="revocation"`, recorder.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func (suite *requestSuite) Test_IPLimitedBeforeBodyIsRead(){
+	limiter := &recordingLimiter{denied: "login:ip:"}
+	suite.server.limiter = limiter
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email": `))
+	suite.server.Login()(recorder, request)
+	suite.Equal(http.StatusTooManyRequests, recorder.Code)
+	suite.Equal("1", recorder.Header().Get("Retry-After"))
+	suite.Equal([]string{"login:ip:192.0.2.1"}, limiter.keys)
+}
+
+func (suite *requestSuite) Test_RefreshLimitedByOwner(){
+	limiter := &recordingLimiter{denied: "refresh:key:"}
+	suite.server.limiter = limiter
+	suite.server.cfg.HttpConfig.MaxBodyBytes = 1024
+	suite.server.cfg.RateLimitConfig.Refresh.Key = config.LimitConfig{Requests: 5, Interval: time.Minute}
+	suite.server.auth = &ownerAuth{uuid: "owner-uuid"}
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/refreshToken", strings.NewReader(`{"token_pair": {"refresh_token": "guessed"}}`))
+	suite.server.RefrashToken()(recorder, request)
+	suite.Equal(http.StatusTooManyRequests, recorder.Code)
+	suite.Equal([]string{"refresh:ip:192.0.2.1", "refresh:key:owner-uuid"}, limiter.keys)
+}
+
+func (suite *requestSuite) Test_RefreshOwnerNotLookedUpWithoutLimit(){
+	auth := &ownerAuth{uuid: "owner-uuid"}
+	suite.server.auth = auth
+	suite.server.cfg.RateLimitConfig.Refresh.Key = config.LimitConfig{Requests: 5, Interval: time.Minute}
+	suite.Empty(suite.server.refreshOwner(httptest.NewRequest(http.MethodPost, "/api/refreshToken", nil), suite.server.log, "token"))
+
+	suite.server.limiter = &recordingLimiter{}
+	suite.server.cfg.RateLimitConfig.Refresh.Key = config.LimitConfig{}
+	suite.Empty(suite.server.refreshOwner(httptest.NewRequest(http.MethodPost, "/api/refreshToken", nil), suite.server.log, "token"))
+	suite.Zero(auth.lookups)
+}
+
+func (suite *requestSuite) Test_ForgedForwardedForIgnored(){
+	request := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	request.Header.Add("X-Forwarded-For", "203.0.113.7, 198.51.100.1")
+	request.Header.Add("X-Forwarded-For", "198.51.100.2")
+	suite.Equal("192.0.2.1", suite.server.clientIP(request))
+
+	suite.server.cfg.RateLimitConfig.TrustedProxies = 1
+	suite.Equal("198.51.100.2", suite.server.clientIP(request))
+	suite.server.cfg.RateLimitConfig.TrustedProxies = 2
+	suite.Equal("198.51.100.1", suite.server.clientIP(request))
+	// header shorter than the chain of proxies was not written by them
+	suite.server.cfg.RateLimitConfig.TrustedProxies = 4
+	suite.Equal("192.0.2.1", suite.server.clientIP(request))
+}
@@ -3,33 +3,67 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/http/middleware"
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
 	v1 "github.com/EwvwGeN/medods_assignment/internal/http/v1"
+	"github.com/EwvwGeN/medods_assignment/internal/ratelimit"
 	"github.com/gorilla/mux"
 )
 
+// shutdownTimeout limits waiting for in-flight requests on shutdown.
+const shutdownTimeout = 5 * time.Second
+
 type server struct {
 	log *slog.Logger
 	cfg config.Config
 	auth Auth
+	backuper Backuper
+	limiter RateLimiter
+	requestObserver middleware.RequestObserver
 	router *mux.Router
 }
 
 type Auth interface {
-	RegisterUser(email string) (uuid string, err error)
-	CreateTokenPair(uuid string) (token, refresh string, err error)
-	RefreshToken(accessToken, refreshToken string) (newToken, newRefresh string, err error)
+	RegisterUser(ctx context.Context, email, password string) (uuid string, err error)
+	Login(ctx context.Context, email, password, device, nonce string) (pair *models.TokenPair, err error)
+	CreateTokenPair(ctx context.Context, uuid, device, nonce string) (pair *models.TokenPair, err error)
+	RefreshToken(ctx context.Context, accessToken, refreshToken string) (newToken, newRefresh string, err error)
+	RefreshTokenOwner(ctx context.Context, refreshToken string) (uuid string, err error)
+	RevokeToken(ctx context.Context, token, tokenTypeHint string) (err error)
+	LogoutAll(ctx context.Context, accessToken string) (err error)
+	IntrospectToken(ctx context.Context, token, tokenTypeHint string) (res *models.IntrospectionResponse, err error)
+	UnlockUser(ctx context.Context, uuid string) (err error)
+	JWKS() models.JWKS
+	Metadata() models.Metadata
+}
+
+// Backuper is implemented by storages which can be copied while serving requests.
+type Backuper interface {
+	Backup(ctx context.Context, w io.Writer) (n int64, err error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, rules ...ratelimit.Rule) (retryAfter time.Duration, allowed bool, err error)
 }
 
-func ServerNewInstance(ctx context.Context, cfg config.Config, log *slog.Logger, auth Auth) *server {
+// ServerNewInstance creates server. backuper is nil when storage does not support backups,
+// limiter is nil when rate limiting is disabled and requestObserver is nil when metrics are disabled.
+func ServerNewInstance(ctx context.Context, cfg config.Config, log *slog.Logger, auth Auth, backuper Backuper, limiter RateLimiter, requestObserver middleware.RequestObserver) *server {
 	return &server{
 		log: log,
 		cfg: cfg,
 		auth: auth,
+		backuper: backuper,
+		limiter: limiter,
+		requestObserver: requestObserver,
 		router: mux.NewRouter(),
 	}
 }
@@ -39,10 +73,12 @@ func (s *server) RunServer(ctx context.Context) (errCloseCh chan error) {
 	s.configureRouter()
 	errCloseCh = make(chan error)
 	srv := &http.Server{
-		Handler: s.router,
+		Handler: s.handler(),
 		Addr:    fmt.Sprintf("%s:%s", s.cfg.HttpConfig.Host, s.cfg.HttpConfig.Port),
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
+		// requests are cancelled together with the server
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 	s.log.Info("starting listening", slog.String("addres", srv.Addr))
 	go func() {
@@ -50,7 +86,10 @@ func (s *server) RunServer(ctx context.Context) (errCloseCh chan error) {
 			select {
 			case <-ctx.Done():
 				s.log.Info("Graceful shutdown server")
-				errCloseCh <- srv.Shutdown(ctx)
+				// ctx is already done, so in-flight requests are only waited for
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				errCloseCh <- srv.Shutdown(shutdownCtx)
+				cancel()
 				return
 			}
 		}
@@ -59,7 +98,25 @@ func (s *server) RunServer(ctx context.Context) (errCloseCh chan error) {
 	return
 }
 
+// handler wraps the router with middlewares, so they also see requests of unknown routes.
+func (s *server) handler() http.Handler {
+	return middleware.Chain(s.router,
+		middleware.RequestID,
+		middleware.Tracing,
+		middleware.Logger(s.log),
+		middleware.AccessLog(s.log),
+		middleware.Recover(s.log),
+	)
+}
+
 func (s *server) configureRouter() {
+	s.router.NotFoundHandler = problem.Handler(http.StatusNotFound, problem.CodeNotFound)
+	s.router.MethodNotAllowedHandler = problem.Handler(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed)
+	s.router.Use(middleware.SpanRoute)
+	if s.requestObserver != nil {
+		s.router.Use(middleware.Metrics(s.requestObserver))
+	}
+
 	s.router.HandleFunc(
 		"/api/healthchecker",
 		v1.Healthcheck(s.cfg.HttpConfig.PingTimeout)).
@@ -71,12 +128,58 @@ func (s *server) configureRouter() {
 	Methods(http.MethodPost)
 
 	s.router.HandleFunc(
-		"/api/createTokenPair/{uuid:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$}",
-		s.CreateTokenPair()).
-	Methods(http.MethodGet)
+		"/api/login",
+		s.Login()).
+	Methods(http.MethodPost)
+
+	if s.cfg.AdminConfig.Enabled {
+		s.router.HandleFunc(
+			"/api/createTokenPair/{uuid:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$}",
+			s.adminOnly(s.CreateTokenPair())).
+		Methods(http.MethodGet)
+	}
+
+	if s.cfg.AdminConfig.Enabled {
+		s.router.HandleFunc(
+			"/api/admin/users/{uuid}/unlock",
+			s.adminOnly(s.UnlockUser())).
+		Methods(http.MethodPost)
+	}
+
+	if s.cfg.AdminConfig.Enabled && s.backuper != nil {
+		s.router.HandleFunc(
+			"/api/admin/backup",
+			s.adminOnly(s.Backup())).
+		Methods(http.MethodGet)
+	}
 
 	s.router.HandleFunc(
 		"/api/refreshToken",
 		s.RefrashToken()).
 	Methods(http.MethodPost)
+
+	s.router.HandleFunc(
+		"/api/revoke",
+		s.RevokeToken()).
+	Methods(http.MethodPost)
+
+	s.router.HandleFunc(
+		"/api/logoutAll",
+		s.LogoutAll()).
+	Methods(http.MethodPost)
+
+	s.router.HandleFunc(
+		"/api/introspect",
+		s.IntrospectToken()).
+	Methods(http.MethodPost)
+
+	s.router.HandleFunc(
+		"/.well-known/jwks.json",
+		s.JWKS()).
+	Methods(http.MethodGet)
+
+	s.router.HandleFunc(
+		"/.well-known/auth-metadata",
+		s.Metadata()).
+	Methods(http.MethodGet)
 }
\ No newline at end of file
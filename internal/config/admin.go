@@ -0,0 +1,8 @@
+package config
+
+type AdminConfig struct {
+	// Enabled registers internal endpoints, like issuing tokens by uuid.
+	Enabled bool `mapstructure:"enabled"`
+	// Token must be passed as bearer token to internal endpoints.
+	Token string `mapstructure:"token"`
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+type BoltConfig struct {
+	Path string `mapstructure:"path"`
+	// OpenTimeout is how long to wait for the file lock held by another process.
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+	// NoSync skips fsync after every commit. It is faster,
+	// but last transactions can be lost on power failure.
+	NoSync bool `mapstructure:"no_sync"`
+	// NoFreelistSync does not write freelist to disk, so commits are faster
+	// but opening the database after crash takes longer.
+	NoFreelistSync  bool          `mapstructure:"no_freelist_sync"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	p "path"
 	"strings"
 	"time"
@@ -14,10 +15,51 @@ var serviceTag string = "auth_service"
 type Config struct {
 	LogLevel    string      `mapstructure:"log_level"`
 	HttpConfig  HttpConfig  `mapstructure:"http"`
+	StorageConfig StorageConfig `mapstructure:"storage"`
 	MongoConfig MongoConfig `mapstructure:"mongo"`
+	PostgresConfig PostgresConfig `mapstructure:"postgres"`
+	BoltConfig BoltConfig `mapstructure:"bolt"`
+	DenylistConfig DenylistConfig `mapstructure:"denylist"`
+	IntrospectionConfig IntrospectionConfig `mapstructure:"introspection"`
+	TimeoutsConfig TimeoutsConfig `mapstructure:"timeouts"`
+	RateLimitConfig RateLimitConfig `mapstructure:"rate_limit"`
+	LockoutConfig LockoutConfig `mapstructure:"lockout"`
+	MetricsConfig MetricsConfig `mapstructure:"metrics"`
+	TracingConfig TracingConfig `mapstructure:"tracing"`
 	TokenTTL time.Duration `mapstructure:"token_ttl"`
 	RefreshTTL time.Duration `mapstructure:"refresh_ttl"`
 	JwtSecret string `mapstructure:"jwt_secret"`
+	RefreshSecret string `mapstructure:"refresh_secret"`
+	JwtConfig JwtConfig `mapstructure:"jwt"`
+	OidcConfig OidcConfig `mapstructure:"oidc"`
+	AdminConfig AdminConfig `mapstructure:"admin"`
+	HasherConfig HasherConfig `mapstructure:"hasher"`
+}
+
+// redacted replaces secrets in logged config.
+const redacted = "REDACTED"
+
+// loggedConfig has no LogValue, so the redacted copy is logged as is.
+type loggedConfig Config
+
+// LogValue hides passwords, secrets and tokens, so the config can be logged.
+func (c Config) LogValue() slog.Value {
+	hide := func(secret *string) {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	hide(&c.JwtSecret)
+	hide(&c.RefreshSecret)
+	hide(&c.MongoConfig.Password)
+	hide(&c.PostgresConfig.Password)
+	hide(&c.AdminConfig.Token)
+	clients := make(map[string]string, len(c.IntrospectionConfig.Clients))
+	for clientId := range c.IntrospectionConfig.Clients {
+		clients[clientId] = redacted
+	}
+	c.IntrospectionConfig.Clients = clients
+	return slog.AnyValue(loggedConfig(c))
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) Test_LogValueHidesSecrets(){
+	cfg := &Config{
+		JwtSecret: "jwt-secret",
+		RefreshSecret: "refresh-secret",
+		MongoConfig: MongoConfig{User: "mongo-user", Password: "mongo-password"},
+		PostgresConfig: PostgresConfig{Password: "postgres-password"},
+		AdminConfig: AdminConfig{Token: "admin-token"},
+		IntrospectionConfig: IntrospectionConfig{Clients: map[string]string{"test-client": "client-secret"}},
+	}
+	buffer := &bytes.Buffer{}
+	slog.New(slog.NewJSONHandler(buffer, nil)).Info("config data", slog.Any("cfg", cfg))
+	logged := buffer.String()
+	for _, secret := range []string{"jwt-secret", "refresh-secret", "mongo-password", "postgres-password", "admin-token", "client-secret"} {
+		suite.NotContains(logged, secret)
+	}
+	suite.Contains(logged, "mongo-user")
+	suite.Contains(logged, "test-client")
+	suite.Equal("client-secret", cfg.IntrospectionConfig.Clients["test-client"])
+}
@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type DenylistConfig struct {
+	Driver          string        `mapstructure:"driver"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
@@ -0,0 +1,11 @@
+package config
+
+type HasherConfig struct {
+	// Algorithm is argon2id or bcrypt, argon2id is used when it is empty.
+	// Hashes of other algorithm are still verified and rehashed on success.
+	Algorithm         string `mapstructure:"algorithm"`
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`
+	Argon2Memory      uint32 `mapstructure:"argon2_memory"`
+	Argon2Iterations  uint32 `mapstructure:"argon2_iterations"`
+	Argon2Parallelism uint8  `mapstructure:"argon2_parallelism"`
+}
@@ -6,4 +6,6 @@ type HttpConfig struct {
 	Host        string  `mapstructure:"host"`
 	Port        string  `mapstructure:"port"`
 	PingTimeout time.Duration `mapstructure:"ping_timeout"`
+	// MaxBodyBytes limits size of request bodies, 64KiB is used when it is not set.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
 }
\ No newline at end of file
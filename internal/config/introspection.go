@@ -0,0 +1,6 @@
+package config
+
+type IntrospectionConfig struct {
+	// Clients maps client id to its secret.
+	Clients map[string]string `mapstructure:"clients"`
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+type JwtConfig struct {
+	// Algorithm is one of HS512, RS256, ES256 or EdDSA.
+	// HS512 with jwt_secret is used when it is empty.
+	Algorithm      string `mapstructure:"algorithm"`
+	PrivateKeyPath string `mapstructure:"private_key_path"`
+	// PreviousKeyPaths are keys of the same algorithm which are
+	// not used for signing anymore but still verify issued tokens.
+	PreviousKeyPaths []string `mapstructure:"previous_key_paths"`
+	// RotationInterval enables generating a new signing key in memory.
+	// It is suitable only for a single instance of the service.
+	RotationInterval time.Duration `mapstructure:"rotation_interval"`
+}
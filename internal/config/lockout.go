@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// LockoutConfig locks the account after Threshold failed attempts made
+// within Window. Lock lasts BaseDuration and doubles with every next
+// failed attempt up to MaxDuration.
+type LockoutConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Threshold    int           `mapstructure:"threshold"`
+	Window       time.Duration `mapstructure:"window"`
+	BaseDuration time.Duration `mapstructure:"base_duration"`
+	MaxDuration  time.Duration `mapstructure:"max_duration"`
+}
@@ -0,0 +1,10 @@
+package config
+
+type MetricsConfig struct {
+	// Enabled serves metrics on the separate listener,
+	// so they are not exposed together with the public api.
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	Port    string `mapstructure:"port"`
+	Path    string `mapstructure:"path"`
+}
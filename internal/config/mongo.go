@@ -1,12 +1,18 @@
 package config
 
 type MongoConfig struct {
-	ConectionFormat string `mapstructure:"db_con_format"`
-	Host            string `mapstructure:"db_host"`
-	Port            string `mapstructure:"db_port"`
-	User            string `mapstructure:"db_user"`
-	Password        string `mapstructure:"db_pass"`
-	AuthSourse      string `mapstructure:"db_auth_source"`
-	Database        string `mapstructure:"db_name"`
-	UserCollection  string `mapstructure:"db_col_user"`
-}
\ No newline at end of file
+	ConectionFormat    string `mapstructure:"db_con_format"`
+	Host               string `mapstructure:"db_host"`
+	Port               string `mapstructure:"db_port"`
+	User               string `mapstructure:"db_user"`
+	Password           string `mapstructure:"db_pass"`
+	AuthSourse         string `mapstructure:"db_auth_source"`
+	Database           string `mapstructure:"db_name"`
+	UserCollection     string `mapstructure:"db_col_user"`
+	SessionCollection  string `mapstructure:"db_col_session"`
+	DenylistCollection string `mapstructure:"db_col_denylist"`
+	// RateLimitCollection keeps buckets of mongo rate limit driver, "rate_limit" is used when it is not set.
+	RateLimitCollection string `mapstructure:"db_col_rate_limit"`
+	// AutoMigrate creates or upgrades collections and indexes on startup.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+}
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+type OidcConfig struct {
+	// Issuer is the base url of the service, it is put into iss claim.
+	Issuer string `mapstructure:"issuer"`
+	// Audience is put into aud claim of id tokens.
+	Audience   string        `mapstructure:"audience"`
+	IdTokenTTL time.Duration `mapstructure:"id_token_ttl"`
+}
@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+type PostgresConfig struct {
+	Host            string        `mapstructure:"db_host"`
+	Port            string        `mapstructure:"db_port"`
+	User            string        `mapstructure:"db_user"`
+	Password        string        `mapstructure:"db_pass"`
+	Database        string        `mapstructure:"db_name"`
+	SSLMode         string        `mapstructure:"db_sslmode"`
+	MaxConns        int32         `mapstructure:"max_conns"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
@@ -0,0 +1,34 @@
+package config
+
+import "time"
+
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Driver is "memory", "storage" or "mongo". Only the mongo storage can keep
+	// buckets, so "storage" falls back to memory for other storages.
+	Driver          string        `mapstructure:"driver"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+	// TrustedProxies is the number of proxies in front of the service which append
+	// the address of their peer to X-Forwarded-For. Zero takes client ip from the connection.
+	TrustedProxies  int              `mapstructure:"trusted_proxies"`
+	Register        RouteLimitConfig `mapstructure:"register"`
+	Login           RouteLimitConfig `mapstructure:"login"`
+	CreateTokenPair RouteLimitConfig `mapstructure:"create_token_pair"`
+	Refresh         RouteLimitConfig `mapstructure:"refresh"`
+}
+
+// RouteLimitConfig limits requests to the route from one ip and with one key.
+// Key is the email for register and login, the uuid for create token pair
+// and the uuid of the refresh token owner for refresh.
+type RouteLimitConfig struct {
+	IP  LimitConfig `mapstructure:"ip"`
+	Key LimitConfig `mapstructure:"key"`
+}
+
+// LimitConfig is a token bucket refilled with Requests tokens every Interval
+// and holding up to Burst tokens. Zero Requests disables the limit.
+type LimitConfig struct {
+	Requests int           `mapstructure:"requests"`
+	Interval time.Duration `mapstructure:"interval"`
+	Burst    int           `mapstructure:"burst"`
+}
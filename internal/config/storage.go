@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+type StorageConfig struct {
+	Driver string `mapstructure:"driver"`
+	// CleanupInterval is how often memory storage removes expired sessions.
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
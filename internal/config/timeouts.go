@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+// TimeoutsConfig limits how long every operation of the service can take,
+// including all storage queries it makes. Zero uses Default, zero Default means no limit.
+type TimeoutsConfig struct {
+	Default         time.Duration `mapstructure:"default"`
+	Register        time.Duration `mapstructure:"register"`
+	Login           time.Duration `mapstructure:"login"`
+	CreateTokenPair time.Duration `mapstructure:"create_token_pair"`
+	Refresh         time.Duration `mapstructure:"refresh"`
+	Revoke          time.Duration `mapstructure:"revoke"`
+	Introspect      time.Duration `mapstructure:"introspect"`
+}
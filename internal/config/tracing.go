@@ -0,0 +1,14 @@
+package config
+
+// TracingConfig configures export of OpenTelemetry traces.
+// Exporter is otlp, stdout or file, SampleRatio is share of new traces
+// which are recorded, traces started by the caller follow its decision.
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	ServiceName string  `mapstructure:"service_name"`
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	FilePath    string  `mapstructure:"file_path"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
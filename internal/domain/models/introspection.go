@@ -0,0 +1,14 @@
+package models
+
+// IntrospectionResponse is described in RFC 7662.
+// Only Active is returned for invalid tokens. Tokens are issued
+// neither to clients nor with scopes, so client_id and scope are omitted.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
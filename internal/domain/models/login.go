@@ -0,0 +1,8 @@
+package models
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Device   string `json:"device,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
@@ -1,9 +1,10 @@
 package models
 
 type RegisterRequest struct {
-	Email string `json:"email"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
 
 type RegisterResponse struct {
 	UUID string `json:"uuid"`
-}
\ No newline at end of file
+}
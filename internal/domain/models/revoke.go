@@ -0,0 +1,7 @@
+package models
+
+// Token type hints described in RFC 7009.
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
@@ -0,0 +1,31 @@
+package models
+
+// Session is a single login of the user on some device.
+// Every session has its own refresh token, so logging in on
+// another device does not affect already existing sessions.
+//
+// Refresh token consists of a selector, which is used to find the session
+// by index, and a verifier, which is stored only as keyed digest.
+//
+// Session is also a refresh token family: every rotation increments
+// Generation and moves the previous token to UsedRefreshes, so a replayed
+// token can be recognized and the whole family revoked.
+type Session struct {
+	Id              string        `bson:"_id"`
+	UUID            string        `bson:"uuid"`
+	Device          string        `bson:"device"`
+	RefreshSelector string        `bson:"refresh_selector"`
+	RefreshDigest   string        `bson:"refresh_digest"`
+	Generation      int64         `bson:"generation"`
+	UsedRefreshes   []UsedRefresh `bson:"used_refresh_tokens"`
+	CreatedAt       int64         `bson:"created_at"`
+	LastUsedAt      int64         `bson:"last_used_at"`
+	ExpiresAt       int64         `bson:"expires_at"`
+	RevokedAt       int64         `bson:"revoked_at"`
+}
+
+// UsedRefresh is already rotated refresh token of the session.
+type UsedRefresh struct {
+	Selector string `bson:"selector"`
+	Digest   string `bson:"digest"`
+}
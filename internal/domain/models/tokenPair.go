@@ -3,4 +3,5 @@ package models
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
-}
\ No newline at end of file
+	IdToken      string `json:"id_token,omitempty"`
+}
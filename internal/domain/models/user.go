@@ -1,9 +1,13 @@
 package models
 
 type User struct {
-	Id          string `bson:"-"`
-	Email       string `bson:"email"`
-	UUID        string `bson:"uuid"`
-	RefreshHash string `bson:"refresh_token"`
-	ExpiresAt   int64  `bson:"expires_at"`
-}
\ No newline at end of file
+	Id           string `bson:"-"`
+	Email        string `bson:"email"`
+	UUID         string `bson:"uuid"`
+	PasswordHash string `bson:"password_hash" json:"-"`
+	// FailedAttempts counts failed logins and refreshes since LastFailedAt,
+	// the account is locked until LockedUntil when there are too many of them.
+	FailedAttempts int   `bson:"failed_attempts" json:"-"`
+	LastFailedAt   int64 `bson:"last_failed_at" json:"-"`
+	LockedUntil    int64 `bson:"locked_until" json:"-"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "github.com/EwvwGeN/medods_assignment/internal/validator"
+
+// Limits of request fields. Password is limited only to bound hashing time,
+// the password policy is checked by the service.
+const (
+	MaxPasswordLength = 1024
+	MaxDeviceLength   = 256
+	MaxNonceLength    = 256
+	MaxTokenLength    = 4096
+)
+
+// Validate checks fields and normalizes the email.
+func (r *RegisterRequest) Validate() error {
+	v := validator.Validator{}
+	v.Email("email", &r.Email)
+	if v.Required("password", r.Password) {
+		v.MaxLength("password", r.Password, MaxPasswordLength)
+	}
+	return v.Err()
+}
+
+// Validate checks fields and normalizes the email.
+func (r *LoginRequest) Validate() error {
+	v := validator.Validator{}
+	v.Email("email", &r.Email)
+	if v.Required("password", r.Password) {
+		v.MaxLength("password", r.Password, MaxPasswordLength)
+	}
+	v.MaxLength("device", r.Device, MaxDeviceLength)
+	v.MaxLength("nonce", r.Nonce, MaxNonceLength)
+	return v.Err()
+}
+
+func (r *RefreshRequest) Validate() error {
+	v := validator.Validator{}
+	if v.Required("token_pair.refresh_token", r.TokenPair.RefreshToken) {
+		v.MaxLength("token_pair.refresh_token", r.TokenPair.RefreshToken, MaxTokenLength)
+	}
+	v.MaxLength("token_pair.access_token", r.TokenPair.AccessToken, MaxTokenLength)
+	return v.Err()
+}
@@ -0,0 +1,106 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+)
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// argon2idAlgorithm uses PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type argon2idAlgorithm struct {
+	params argon2Params
+}
+
+func newArgon2id(memory, iterations uint32, parallelism uint8) *argon2idAlgorithm {
+	if memory == 0 {
+		memory = defaultArgon2Memory
+	}
+	if iterations == 0 {
+		iterations = defaultArgon2Iterations
+	}
+	if parallelism == 0 {
+		parallelism = defaultArgon2Parallelism
+	}
+	return &argon2idAlgorithm{
+		params: argon2Params{
+			memory:      memory,
+			iterations:  iterations,
+			parallelism: parallelism,
+		},
+	}
+}
+
+func (a *argon2idAlgorithm) hash(secret string) (encoded string, err error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(secret), salt, a.params.iterations, a.params.memory, a.params.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.params.memory,
+		a.params.iterations,
+		a.params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idAlgorithm) verify(secret, encoded string) (ok bool, err error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	otherKey := argon2.IDKey([]byte(secret), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func (a *argon2idAlgorithm) sameParams(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err == nil && params == a.params
+}
+
+func decodeArgon2id(encoded string) (params argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrIncompatibleVersion
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
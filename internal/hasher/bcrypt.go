@@ -0,0 +1,45 @@
+package hasher
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptAlgorithm uses standard bcrypt encoding, e.g. $2a$10$<salt><hash>.
+type bcryptAlgorithm struct {
+	cost int
+}
+
+func newBcrypt(cost int) *bcryptAlgorithm {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptAlgorithm{
+		cost: cost,
+	}
+}
+
+func (b *bcryptAlgorithm) hash(secret string) (encoded string, err error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *bcryptAlgorithm) verify(secret, encoded string) (ok bool, err error) {
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(secret))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, ErrInvalidHash
+	}
+	return true, nil
+}
+
+func (b *bcryptAlgorithm) sameParams(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.cost
+}
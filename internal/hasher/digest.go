@@ -0,0 +1,31 @@
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// digester computes keyed digests of random high entropy secrets, like refresh tokens.
+// Unlike password hashes they are deterministic and cheap, so the secret can be
+// found by index and checked in constant time.
+type digester struct {
+	key []byte
+}
+
+func NewDigester(key string) *digester {
+	return &digester{
+		key: []byte(key),
+	}
+}
+
+// Digest returns hex encoded HMAC-SHA256 of the secret.
+func (d *digester) Digest(secret string) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *digester) Verify(secret, digest string) bool {
+	return hmac.Equal([]byte(d.Digest(secret)), []byte(digest))
+}
@@ -0,0 +1,9 @@
+package hasher
+
+import "errors"
+
+var (
+	ErrUnknownAlgorithm    = errors.New("unknown hashing algorithm")
+	ErrInvalidHash         = errors.New("invalid encoded hash")
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+)
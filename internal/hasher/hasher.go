@@ -0,0 +1,79 @@
+package hasher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+)
+
+// Supported hashing algorithms.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// algorithm hashes secrets into encoded strings which contain
+// the algorithm and its parameters along with salt and hash.
+type algorithm interface {
+	hash(secret string) (encoded string, err error)
+	verify(secret, encoded string) (ok bool, err error)
+	// sameParams reports whether encoded hash was produced with the current parameters.
+	sameParams(encoded string) bool
+}
+
+type hasher struct {
+	name       string
+	current    algorithm
+	algorithms map[string]algorithm
+}
+
+// NewHasher creates hasher which hashes with the configured algorithm
+// and verifies hashes of every supported algorithm.
+func NewHasher(cfg config.HasherConfig) (*hasher, error) {
+	algorithms := map[string]algorithm{
+		AlgorithmBcrypt:   newBcrypt(cfg.BcryptCost),
+		AlgorithmArgon2id: newArgon2id(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism),
+	}
+	name := cfg.Algorithm
+	if name == "" {
+		name = AlgorithmArgon2id
+	}
+	current, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, name)
+	}
+	return &hasher{
+		name:       name,
+		current:    current,
+		algorithms: algorithms,
+	}, nil
+}
+
+func (h *hasher) Hash(secret string) (encoded string, err error) {
+	return h.current.hash(secret)
+}
+
+func (h *hasher) Verify(secret, encoded string) (ok bool, err error) {
+	algorithm, ok := h.algorithms[identify(encoded)]
+	if !ok {
+		return false, ErrUnknownAlgorithm
+	}
+	return algorithm.verify(secret, encoded)
+}
+
+// NeedsRehash reports whether encoded hash was produced with another
+// algorithm or parameters than configured now.
+func (h *hasher) NeedsRehash(encoded string) bool {
+	return identify(encoded) != h.name || !h.current.sameParams(encoded)
+}
+
+func identify(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+	bcryptCfg config.HasherConfig
+	argon2Cfg config.HasherConfig
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) SetupSuite() {
+	suite.bcryptCfg = config.HasherConfig{
+		Algorithm: AlgorithmBcrypt,
+		BcryptCost: 4,
+	}
+	suite.argon2Cfg = config.HasherConfig{
+		Algorithm: AlgorithmArgon2id,
+		Argon2Memory: 1024,
+		Argon2Iterations: 1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func (suite *testSuite) Test_HashAndVerifyHappyPass(){
+	for _, cfg := range []config.HasherConfig{suite.bcryptCfg, suite.argon2Cfg} {
+		h, err := NewHasher(cfg)
+		suite.Require().NoError(err)
+		encoded, err := h.Hash("test_secret")
+		suite.Require().NoError(err, cfg.Algorithm)
+		suite.Require().NotEqual("test_secret", encoded)
+		ok, err := h.Verify("test_secret", encoded)
+		suite.Require().NoError(err, cfg.Algorithm)
+		suite.True(ok, cfg.Algorithm)
+		ok, err = h.Verify("wrong_secret", encoded)
+		suite.Require().NoError(err, cfg.Algorithm)
+		suite.False(ok, cfg.Algorithm)
+		suite.False(h.NeedsRehash(encoded), cfg.Algorithm)
+	}
+}
+
+func (suite *testSuite) Test_Argon2idPHCFormat(){
+	h, err := NewHasher(suite.argon2Cfg)
+	suite.Require().NoError(err)
+	encoded, err := h.Hash("test_secret")
+	suite.Require().NoError(err)
+	suite.True(strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	suite.Len(strings.Split(encoded, "$"), 6)
+}
+
+func (suite *testSuite) Test_VerifyOtherAlgorithm(){
+	bcryptHasher, err := NewHasher(suite.bcryptCfg)
+	suite.Require().NoError(err)
+	argon2Hasher, err := NewHasher(suite.argon2Cfg)
+	suite.Require().NoError(err)
+	encoded, err := bcryptHasher.Hash("test_secret")
+	suite.Require().NoError(err)
+	ok, err := argon2Hasher.Verify("test_secret", encoded)
+	suite.Require().NoError(err)
+	suite.True(ok)
+	suite.True(argon2Hasher.NeedsRehash(encoded))
+}
+
+func (suite *testSuite) Test_NeedsRehashOnParamsChange(){
+	h, err := NewHasher(suite.argon2Cfg)
+	suite.Require().NoError(err)
+	encoded, err := h.Hash("test_secret")
+	suite.Require().NoError(err)
+	cfg := suite.argon2Cfg
+	cfg.Argon2Iterations = 2
+	stronger, err := NewHasher(cfg)
+	suite.Require().NoError(err)
+	suite.True(stronger.NeedsRehash(encoded))
+	ok, err := stronger.Verify("test_secret", encoded)
+	suite.Require().NoError(err)
+	suite.True(ok)
+}
+
+func (suite *testSuite) Test_VerifyBrokenHash(){
+	h, err := NewHasher(suite.argon2Cfg)
+	suite.Require().NoError(err)
+	_, err = h.Verify("test_secret", "plain_text")
+	suite.Require().ErrorIs(err, ErrUnknownAlgorithm)
+	_, err = h.Verify("test_secret", "$argon2id$v=19$m=1024$broken")
+	suite.Require().ErrorIs(err, ErrInvalidHash)
+}
+
+func (suite *testSuite) Test_UnknownAlgorithm(){
+	_, err := NewHasher(config.HasherConfig{Algorithm: "md5"})
+	suite.Require().ErrorIs(err, ErrUnknownAlgorithm)
+}
@@ -0,0 +1,203 @@
+// Package middleware contains handlers wrapping every request of the server.
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	guuid "github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits id passed by the client, longer ones are replaced.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Chain wraps handler with middlewares, the first one is the outermost.
+func Chain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// RequestID takes id of the request from X-Request-ID header or generates new one.
+// The id is returned in the response header, so the client can report it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = guuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns id set by RequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// id is put into logs and headers, so only visible ascii is accepted
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Logger puts log with id of the request and ids of its trace into the request context.
+// It must be used after RequestID and Tracing.
+func Logger(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLog := log.With(slog.String("request_id", RequestIDFromContext(r.Context())))
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+				reqLog = reqLog.With(
+					slog.String("trace_id", spanContext.TraceID().String()),
+					slog.String("span_id", spanContext.SpanID().String()),
+				)
+			}
+			next.ServeHTTP(w, r.WithContext(logger.ContextWithLogger(r.Context(), reqLog)))
+		})
+	}
+}
+
+// AccessLog writes record for every finished request.
+// Server errors are logged with warn level.
+func AccessLog(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			level := slog.LevelInfo
+			if rec.Status() >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+			logger.FromContext(r.Context(), log).LogAttrs(r.Context(), level, "request served",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.Status()),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		})
+	}
+}
+
+// Recover turns panic of the handler into 500 response, so the connection
+// is not closed without response and the panic is logged with its stack.
+func Recover(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				// handler asked to abort the response, server handles it by itself
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				logger.FromContext(r.Context(), log).Error("handler panicked",
+					slog.Any("panic", recovered),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if rec.status != 0 {
+					// response is already started, so only the body can be broken
+					return
+				}
+				problem.Write(rec, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, ""))
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+type RequestObserver interface {
+	ObserveRequest(route, method string, status int, duration time.Duration)
+}
+
+// Metrics passes requests to observer with the path template of the route,
+// so the number of routes does not depend on requested paths.
+// It must be used by mux.Router, which sets the matched route.
+func Metrics(observer RequestObserver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			route := routeTemplate(r)
+			if route == "" {
+				route = "unknown"
+			}
+			observer.ObserveRequest(route, r.Method, rec.Status(), time.Since(start))
+		})
+	}
+}
+
+// routeTemplate returns path template of the route matched by mux.Router or empty string.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
+
+// responseRecorder remembers status and size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Status returns 200 when nothing was written, as the server does.
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Unwrap is used by http.ResponseController to reach the original writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/http/problem"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+	logs *bytes.Buffer
+	log  *slog.Logger
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) SetupTest() {
+	suite.logs = &bytes.Buffer{}
+	suite.log = slog.New(slog.NewJSONHandler(suite.logs, nil))
+}
+
+func (suite *testSuite) serve(handler http.HandlerFunc, requestID string) *httptest.ResponseRecorder {
+	chain := Chain(handler, RequestID, Logger(suite.log), AccessLog(suite.log), Recover(suite.log))
+	request := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	if requestID != "" {
+		request.Header.Set(RequestIDHeader, requestID)
+	}
+	recorder := httptest.NewRecorder()
+	chain.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// records returns json log records written during the test.
+func (suite *testSuite) records() []map[string]any {
+	records := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(suite.logs.String()), "\n") {
+		record := map[string]any{}
+		suite.Require().NoError(json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func (suite *testSuite) Test_RequestID(){
+	var ctxID string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		ctxID = RequestIDFromContext(r.Context())
+		logger.FromContext(r.Context(), nil).Info("handled")
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	recorder := suite.serve(handler, "client-request-1")
+	suite.Equal("client-request-1", recorder.Header().Get(RequestIDHeader))
+	suite.Equal("client-request-1", ctxID)
+	records := suite.records()
+	suite.Require().Len(records, 2)
+	suite.Equal("client-request-1", records[0]["request_id"])
+	suite.Equal("request served", records[1]["msg"])
+	suite.Equal("client-request-1", records[1]["request_id"])
+	suite.EqualValues(http.StatusTeapot, records[1]["status"])
+
+	recorder = suite.serve(handler, "bad id\n")
+	suite.NotEqual("bad id\n", recorder.Header().Get(RequestIDHeader))
+	suite.Equal(ctxID, recorder.Header().Get(RequestIDHeader))
+	suite.Len(ctxID, 36)
+}
+
+func (suite *testSuite) Test_Recover(){
+	recorder := suite.serve(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}, "")
+	suite.Equal(http.StatusInternalServerError, recorder.Code)
+	res := problem.Problem{}
+	suite.Require().NoError(json.Unmarshal(recorder.Body.Bytes(), &res))
+	suite.Equal(problem.CodeInternal, res.Code)
+
+	records := suite.records()
+	suite.Require().Len(records, 2)
+	suite.Equal("handler panicked", records[0]["msg"])
+	suite.Equal("boom", records[0]["panic"])
+	suite.Equal("WARN", records[1]["level"])
+	suite.EqualValues(http.StatusInternalServerError, records[1]["status"])
+}
+
+func (suite *testSuite) Test_ResponseControllerReachesWriter(){
+	suite.serve(func(w http.ResponseWriter, r *http.Request) {
+		suite.NoError(http.NewResponseController(w).Flush())
+	}, "")
+}
+
+type observedRequest struct {
+	route  string
+	method string
+	status int
+}
+
+type recordingObserver struct {
+	observed []observedRequest
+}
+
+func (o *recordingObserver) ObserveRequest(route, method string, status int, duration time.Duration) {
+	o.observed = append(o.observed, observedRequest{route: route, method: method, status: status})
+}
+
+func (suite *testSuite) Test_MetricsUsesRouteTemplate(){
+	observer := &recordingObserver{}
+	router := mux.NewRouter()
+	router.Use(Metrics(observer))
+	router.HandleFunc("/api/users/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodPost)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/users/first", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/users/second", nil))
+	suite.Equal([]observedRequest{
+		{route: "/api/users/{uuid}", method: http.MethodPost, status: http.StatusNoContent},
+		{route: "/api/users/{uuid}", method: http.MethodPost, status: http.StatusNoContent},
+	}, observer.observed)
+}
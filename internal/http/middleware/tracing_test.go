@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+var (
+	// package tracer delegates only to the first global provider,
+	// so spans of all test runs are recorded by one provider
+	spans             = tracetest.NewSpanRecorder()
+	setTracerProvider sync.Once
+)
+
+// endedSpans returns ended spans of the trace.
+func endedSpans(traceId string) []sdktrace.ReadOnlySpan {
+	ended := []sdktrace.ReadOnlySpan{}
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID().String() == traceId {
+			ended = append(ended, span)
+		}
+	}
+	return ended
+}
+
+func (suite *testSuite) Test_TracingContinuesTrace(){
+	setTracerProvider.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	})
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traceIdBytes := make([]byte, 16)
+	_, err := rand.Read(traceIdBytes)
+	suite.Require().NoError(err)
+	traceId := hex.EncodeToString(traceIdBytes)
+
+	router := mux.NewRouter()
+	router.Use(SpanRoute)
+	router.HandleFunc("/api/users/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context(), nil).Info("handled")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/api/users/first", nil)
+	request.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	Chain(router, RequestID, Tracing, Logger(suite.log)).ServeHTTP(httptest.NewRecorder(), request)
+
+	ended := endedSpans(traceId)
+	suite.Require().Len(ended, 1)
+	span := ended[0]
+	suite.Equal("GET /api/users/{uuid}", span.Name())
+	suite.Equal(traceId, span.SpanContext().TraceID().String())
+	suite.Equal("00f067aa0ba902b7", span.Parent().SpanID().String())
+	suite.Contains(span.Attributes(), semconv.HTTPRoute("/api/users/{uuid}"))
+	suite.Contains(span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+	suite.Equal("Error", span.Status().Code.String())
+
+	records := suite.records()
+	suite.Require().Len(records, 1)
+	suite.Equal(traceId, records[0]["trace_id"])
+	suite.Equal(span.SpanContext().SpanID().String(), records[0]["span_id"])
+}
@@ -0,0 +1,85 @@
+// Package problem writes error responses as described in RFC 7807.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Stable machine-readable codes, clients should rely on them instead of detail.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidClient      = "invalid_client"
+	CodeInvalidToken       = "invalid_token"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeRefreshReused      = "refresh_token_reused"
+	CodeRefreshConflict    = "refresh_token_conflict"
+	CodeAccountLocked      = "account_locked"
+	CodeUserExists         = "user_exists"
+	CodeUserNotFound       = "user_not_found"
+	CodeSessionNotFound    = "session_not_found"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeRateLimited        = "rate_limited"
+	CodeTimeout            = "timeout"
+	CodeUnavailable        = "storage_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// Problem is RFC 7807 problem details object with code extension member.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists invalid fields of the request.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New creates problem of the status. Problems are distinguished by code,
+// so type is always "about:blank" and title is the status text.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write writes the problem with instance set to the request path.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, p.Title, p.Status)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// Handler always responds with the problem, it is used for not found
+// and not allowed routes.
+func Handler(status int, code string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, New(status, code, ""))
+	})
+}
@@ -0,0 +1,37 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) Test_Write(){
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	Write(recorder, request, New(http.StatusUnauthorized, CodeInvalidCredentials, "invalid email or password"))
+
+	suite.Equal(http.StatusUnauthorized, recorder.Code)
+	suite.Equal(ContentType, recorder.Header().Get("Content-Type"))
+	res := Problem{}
+	suite.Require().NoError(json.Unmarshal(recorder.Body.Bytes(), &res))
+	suite.Equal(Problem{
+		Type: "about:blank",
+		Title: "Unauthorized",
+		Status: http.StatusUnauthorized,
+		Detail: "invalid email or password",
+		Instance: "/api/login",
+		Code: CodeInvalidCredentials,
+	}, res)
+}
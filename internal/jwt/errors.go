@@ -6,4 +6,9 @@ var (
 	ErrEmptyValue = errors.New("empty value")
 	ErrRefreshGenerate = errors.New("cant generate refresh token")
 	ErrParseClaims = errors.New("cant get claims from token")
-)
\ No newline at end of file
+	ErrLoadKey = errors.New("cant load signing key")
+	ErrUnknownAlgorithm = errors.New("unknown signing algorithm")
+	ErrUnexpectedAlgorithm = errors.New("unexpected token signing algorithm")
+	ErrUnknownKey = errors.New("unknown signing key id")
+	ErrRotationUnsupported = errors.New("key rotation is not supported for algorithm")
+)
@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+)
+
+// publicJWK returns verification key in JWK format.
+// ok is false for symmetric keys, they must never be published.
+func publicJWK(key *signingKey) (jwk models.JWK, ok bool) {
+	jwk = models.JWK{
+		Use: "sig",
+		Alg: key.method.Alg(),
+		Kid: key.kid,
+	}
+	switch pub := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeSegment(pub.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeSegment(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeSegment(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeSegment(pub)
+	default:
+		return models.JWK{}, false
+	}
+	return jwk, true
+}
+
+// keyId returns JWK thumbprint described in RFC 7638 for asymmetric keys.
+// For HMAC secret the id is derived with the secret itself, so it does not disclose it.
+func keyId(key *signingKey) string {
+	jwk, ok := publicJWK(key)
+	if !ok {
+		mac := hmac.New(sha256.New, key.verifyKey.([]byte))
+		mac.Write([]byte("kid"))
+		return encodeSegment(mac.Sum(nil)[:12])
+	}
+	// members must be in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	raw, _ := json.Marshal(members)
+	sum := sha256.Sum256(raw)
+	return encodeSegment(sum[:])
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -1,37 +1,110 @@
 package jwt
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
-	"math/rand"
+	"log/slog"
 	"time"
 
+	"github.com/EwvwGeN/medods_assignment/internal/config"
 	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
+// JWKSMaxAge is how long clients may cache JWKS.
+const JWKSMaxAge = 5 * time.Minute
+
 type jwtManager struct {
-	secretKey string
+	algorithm string
+	keys      *keySet
 }
 
+// NewJwtManager creates manager signing tokens with HS512 and the shared secret.
 func NewJwtManager(secretKey string) *jwtManager {
 	return &jwtManager{
-		secretKey: secretKey,
+		algorithm: AlgorithmHS512,
+		keys:      newKeySet(newHMACKey(secretKey)),
 	}
 }
 
-func (jm *jwtManager) CreateJwt(user *models.User, ttl time.Duration) (token string, err error) {
+// NewJwtManagerFromConfig creates manager for the configured algorithm.
+// HS512 with the shared secret is used when algorithm is not set.
+func NewJwtManagerFromConfig(cfg config.JwtConfig, secretKey string) (*jwtManager, error) {
+	if cfg.Algorithm == "" || cfg.Algorithm == AlgorithmHS512 {
+		if secretKey == "" {
+			return nil, fmt.Errorf("%w: jwt secret", ErrEmptyValue)
+		}
+		return NewJwtManager(secretKey), nil
+	}
+	key, err := loadSigningKey(cfg.Algorithm, cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	previous := make([]*signingKey, 0, len(cfg.PreviousKeyPaths))
+	for _, path := range cfg.PreviousKeyPaths {
+		previousKey, err := loadSigningKey(cfg.Algorithm, path)
+		if err != nil {
+			return nil, fmt.Errorf("previous key %s: %w", path, err)
+		}
+		previous = append(previous, previousKey)
+	}
+	return &jwtManager{
+		algorithm: cfg.Algorithm,
+		keys:      newKeySet(key, previous...),
+	}, nil
+}
+
+func (jm *jwtManager) CreateJwt(user *models.User, sessionId string, ttl time.Duration) (token string, err error) {
 	if user.Email == "" {
 		return "", ErrEmptyValue
 	}
 	if user.UUID == "" {
 		return "", ErrEmptyValue
 	}
-	tokenObject := jwt.New(jwt.SigningMethodHS512)
+	if sessionId == "" {
+		return "", ErrEmptyValue
+	}
+	key := jm.keys.signing()
+	tokenObject := jwt.New(key.method)
+	tokenObject.Header["kid"] = key.kid
 	claims := tokenObject.Claims.(jwt.MapClaims)
 	claims["uuid"] = user.UUID
 	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(ttl).Unix()
-	token, err = tokenObject.SignedString([]byte(jm.secretKey))
+	claims["sid"] = sessionId
+	claims["jti"] = uuid.NewString()
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	token, err = tokenObject.SignedString(key.signKey)
+	if err != nil {
+		return "", err
+	}
+	return
+}
+
+// CreateIdToken creates OpenID Connect id token of the user.
+// nonce is omitted when it is empty.
+func (jm *jwtManager) CreateIdToken(user *models.User, issuer, audience, nonce string, ttl time.Duration) (token string, err error) {
+	if user.UUID == "" || issuer == "" || audience == "" {
+		return "", ErrEmptyValue
+	}
+	key := jm.keys.signing()
+	tokenObject := jwt.New(key.method)
+	tokenObject.Header["kid"] = key.kid
+	claims := tokenObject.Claims.(jwt.MapClaims)
+	claims["iss"] = issuer
+	claims["aud"] = audience
+	claims["sub"] = user.UUID
+	claims["email"] = user.Email
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	token, err = tokenObject.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -40,17 +113,24 @@ func (jm *jwtManager) CreateJwt(user *models.User, ttl time.Duration) (token str
 
 func (jm *jwtManager) CreateRefresh() (refresh string, err error) {
 	buffer := make([]byte, 32)
-	gen := rand.New(rand.NewSource(time.Now().Unix()))
-	if _, err = gen.Read(buffer); err != nil {
+	if _, err = rand.Read(buffer); err != nil {
 		return "", ErrRefreshGenerate
 	}
 	return fmt.Sprintf("%x", buffer), nil
 }
 
 func (jm *jwtManager) ParseTokenClaims(token string) (jwt.MapClaims, error) {
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		return []byte(jm.secretKey), nil
-	})
+	return jm.parseClaims(&jwt.Parser{}, token)
+}
+
+// ParseTokenClaimsWithoutExpiry checks only the signature of the token,
+// so claims of the expired token are returned too.
+func (jm *jwtManager) ParseTokenClaimsWithoutExpiry(token string) (jwt.MapClaims, error) {
+	return jm.parseClaims(&jwt.Parser{SkipClaimsValidation: true}, token)
+}
+
+func (jm *jwtManager) parseClaims(parser *jwt.Parser, token string) (jwt.MapClaims, error) {
+	parsedToken, err := parser.Parse(token, jm.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -59,4 +139,94 @@ func (jm *jwtManager) ParseTokenClaims(token string) (jwt.MapClaims, error) {
 		return nil, ErrParseClaims
 	}
 	return claims, nil
-}
\ No newline at end of file
+}
+
+func (jm *jwtManager) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := jm.keys.verification(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnexpectedAlgorithm
+	}
+	return key.verifyKey, nil
+}
+
+// Algorithm returns the name of the signing algorithm.
+func (jm *jwtManager) Algorithm() string {
+	return jm.algorithm
+}
+
+// JWKS returns public keys which can be used to verify issued tokens.
+// It is empty when tokens are signed with the shared secret.
+func (jm *jwtManager) JWKS() models.JWKS {
+	jwks := models.JWKS{
+		Keys: []models.JWK{},
+	}
+	for _, key := range jm.keys.verificationKeys() {
+		if jwk, ok := publicJWK(key); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// RotateKey makes the key published by PublishKey active or generates a new one.
+// Previous key stays in JWKS and verifies tokens during retention,
+// which must not be less than tokens ttl.
+func (jm *jwtManager) RotateKey(retention time.Duration) (kid string, err error) {
+	key := jm.keys.published()
+	if key == nil {
+		key, err = generateSigningKey(jm.algorithm)
+		if err != nil {
+			return "", err
+		}
+	}
+	jm.keys.rotate(key, retention)
+	return key.kid, nil
+}
+
+// PublishKey generates the key used by the next rotation and adds it to JWKS,
+// so verifiers which cache JWKS know the key before tokens are signed with it.
+func (jm *jwtManager) PublishKey() (kid string, err error) {
+	key, err := generateSigningKey(jm.algorithm)
+	if err != nil {
+		return "", err
+	}
+	jm.keys.publish(key)
+	return key.kid, nil
+}
+
+// RunRotation rotates signing key every interval until ctx is done.
+// Every key is published one interval before it becomes active,
+// so interval must not be less than JWKSMaxAge.
+// Generated keys live only in memory of this instance.
+func (jm *jwtManager) RunRotation(ctx context.Context, log *slog.Logger, interval, retention time.Duration) {
+	log = log.With(slog.String("component", "jwt_key_rotation"))
+	publish := func() {
+		kid, err := jm.PublishKey()
+		if err != nil {
+			log.Error("failed to publish signing key", slog.String("error", err.Error()))
+			return
+		}
+		log.Info("next signing key published", slog.String("kid", kid))
+	}
+	publish()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			kid, err := jm.RotateKey(retention)
+			if err != nil {
+				log.Error("failed to rotate signing key", slog.String("error", err.Error()))
+				continue
+			}
+			log.Info("signing key rotated", slog.String("kid", kid))
+			publish()
+		}
+	}
+}
@@ -1,10 +1,21 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/EwvwGeN/medods_assignment/internal/config"
 	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 )
@@ -29,8 +40,9 @@ func (suite *testSuite) Test_CreateTokenHappyPass(){
 		Email: "test@test.test",
 		UUID: uuid.NewString(),
 	}
+	sessionId := uuid.NewString()
 	duration := time.Duration(10*time.Second)
-	token, err := suite.jwtManager.CreateJwt(&user, duration)
+	token, err := suite.jwtManager.CreateJwt(&user, sessionId, duration)
 	creatingTime := time.Now()
 	suite.Require().NoError(err)
 	suite.Require().NotEmpty(token)
@@ -38,15 +50,35 @@ func (suite *testSuite) Test_CreateTokenHappyPass(){
 	suite.Require().NoError(err)
 	suite.Equal(user.UUID, claims["uuid"].(string))
 	suite.Equal(user.Email, claims["email"].(string))
+	suite.Equal(sessionId, claims["sid"].(string))
+	suite.NotEmpty(claims["jti"].(string))
+	suite.InDelta(creatingTime.Unix(), claims["iat"].(float64), 1)
 	suite.InDelta(creatingTime.Add(duration).Unix(), claims["exp"].(float64), 1)
 }
 
+func (suite *testSuite) Test_ParseExpiredToken(){
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	token, err := suite.jwtManager.CreateJwt(&user, uuid.NewString(), -time.Minute)
+	suite.Require().NoError(err)
+	_, err = suite.jwtManager.ParseTokenClaims(token)
+	suite.Require().Error(err)
+	claims, err := suite.jwtManager.ParseTokenClaimsWithoutExpiry(token)
+	suite.Require().NoError(err)
+	suite.Equal(user.UUID, claims["uuid"].(string))
+
+	_, err = NewJwtManager("other_secret_key").ParseTokenClaimsWithoutExpiry(token)
+	suite.Error(err)
+}
+
 func (suite *testSuite) Test_CreateTokenEmptyEmail(){
 	user := models.User{
 		UUID: uuid.NewString(),
 	}
 	duration := time.Duration(10*time.Second)
-	token, err := suite.jwtManager.CreateJwt(&user, duration)
+	token, err := suite.jwtManager.CreateJwt(&user, uuid.NewString(), duration)
 	suite.Require().Error(err)
 	suite.Require().Empty(token)
 }
@@ -56,7 +88,18 @@ func (suite *testSuite) Test_CreateTokenEmptyUUID(){
 		Email: "test@test.test",
 	}
 	duration := time.Duration(10*time.Second)
-	token, err := suite.jwtManager.CreateJwt(&user, duration)
+	token, err := suite.jwtManager.CreateJwt(&user, uuid.NewString(), duration)
+	suite.Require().Error(err)
+	suite.Require().Empty(token)
+}
+
+func (suite *testSuite) Test_CreateTokenEmptySession(){
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	duration := time.Duration(10*time.Second)
+	token, err := suite.jwtManager.CreateJwt(&user, "", duration)
 	suite.Require().Error(err)
 	suite.Require().Empty(token)
 }
@@ -64,5 +107,174 @@ func (suite *testSuite) Test_CreateTokenEmptyUUID(){
 func (suite *testSuite) Test_CreateRefreshHappyPass(){
 	refresh, err := suite.jwtManager.CreateRefresh()
 	suite.Require().NoError(err)
-	suite.Require().Empty(refresh)
-}
\ No newline at end of file
+	suite.Require().NotEmpty(refresh)
+}
+func (suite *testSuite) Test_AsymmetricAlgorithmsHappyPass(){
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	suite.Require().NoError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	keys := map[string]interface{}{
+		AlgorithmRS256: rsaKey,
+		AlgorithmES256: ecKey,
+		AlgorithmEdDSA: edKey,
+	}
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	for algorithm, key := range keys {
+		manager, err := NewJwtManagerFromConfig(config.JwtConfig{
+			Algorithm: algorithm,
+			PrivateKeyPath: suite.writeKey(key),
+		}, "")
+		suite.Require().NoError(err, algorithm)
+		token, err := manager.CreateJwt(&user, uuid.NewString(), 10*time.Second)
+		suite.Require().NoError(err, algorithm)
+		claims, err := manager.ParseTokenClaims(token)
+		suite.Require().NoError(err, algorithm)
+		suite.Equal(user.UUID, claims["uuid"].(string), algorithm)
+		_, err = suite.jwtManager.ParseTokenClaims(token)
+		suite.Require().Error(err, algorithm)
+	}
+}
+
+func (suite *testSuite) Test_ES256WrongCurve(){
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	suite.Require().NoError(err)
+	_, err = NewJwtManagerFromConfig(config.JwtConfig{
+		Algorithm: AlgorithmES256,
+		PrivateKeyPath: suite.writeKey(ecKey),
+	}, "")
+	suite.Require().ErrorIs(err, ErrLoadKey)
+}
+
+func (suite *testSuite) Test_UnknownAlgorithm(){
+	_, err := NewJwtManagerFromConfig(config.JwtConfig{
+		Algorithm: "none",
+		PrivateKeyPath: "key.pem",
+	}, "")
+	suite.Require().Error(err)
+}
+
+func (suite *testSuite) writeKey(key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	suite.Require().NoError(err)
+	path := filepath.Join(suite.T().TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	suite.Require().NoError(err)
+	return path
+}
+
+func (suite *testSuite) Test_KeyRotation(){
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	manager, err := NewJwtManagerFromConfig(config.JwtConfig{
+		Algorithm: AlgorithmEdDSA,
+		PrivateKeyPath: suite.writeKey(edKey),
+	}, "")
+	suite.Require().NoError(err)
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	oldToken, err := manager.CreateJwt(&user, uuid.NewString(), 10*time.Second)
+	suite.Require().NoError(err)
+	suite.Require().Len(manager.JWKS().Keys, 1)
+	oldKid := manager.JWKS().Keys[0].Kid
+
+	newKid, err := manager.RotateKey(time.Minute)
+	suite.Require().NoError(err)
+	suite.NotEqual(oldKid, newKid)
+	suite.Require().Len(manager.JWKS().Keys, 2)
+	newToken, err := manager.CreateJwt(&user, uuid.NewString(), 10*time.Second)
+	suite.Require().NoError(err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, jwt.MapClaims{})
+	suite.Require().NoError(err)
+	suite.Equal(newKid, parsed.Header["kid"])
+	_, err = manager.ParseTokenClaims(oldToken)
+	suite.Require().NoError(err)
+
+	_, err = manager.RotateKey(-time.Second)
+	suite.Require().NoError(err)
+	_, err = manager.ParseTokenClaims(newToken)
+	suite.Require().Error(err)
+	suite.Require().Len(manager.JWKS().Keys, 2)
+}
+
+func (suite *testSuite) Test_KeyIsPublishedBeforeSigning(){
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	suite.Require().NoError(err)
+	manager, err := NewJwtManagerFromConfig(config.JwtConfig{
+		Algorithm: AlgorithmEdDSA,
+		PrivateKeyPath: suite.writeKey(edKey),
+	}, "")
+	suite.Require().NoError(err)
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	oldKid := manager.JWKS().Keys[0].Kid
+
+	nextKid, err := manager.PublishKey()
+	suite.Require().NoError(err)
+	suite.Require().Len(manager.JWKS().Keys, 2)
+	suite.Equal(nextKid, manager.JWKS().Keys[1].Kid)
+	token, err := manager.CreateJwt(&user, uuid.NewString(), 10*time.Second)
+	suite.Require().NoError(err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	suite.Require().NoError(err)
+	suite.Equal(oldKid, parsed.Header["kid"])
+
+	newKid, err := manager.RotateKey(time.Minute)
+	suite.Require().NoError(err)
+	suite.Equal(nextKid, newKid)
+	suite.Require().Len(manager.JWKS().Keys, 2)
+	token, err = manager.CreateJwt(&user, uuid.NewString(), 10*time.Second)
+	suite.Require().NoError(err)
+	parsed, _, err = new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	suite.Require().NoError(err)
+	suite.Equal(nextKid, parsed.Header["kid"])
+}
+
+func (suite *testSuite) Test_SharedSecretIsNotPublished(){
+	suite.Empty(suite.jwtManager.JWKS().Keys)
+	_, err := suite.jwtManager.RotateKey(time.Minute)
+	suite.Require().ErrorIs(err, ErrRotationUnsupported)
+}
+
+func (suite *testSuite) Test_CreateIdTokenHappyPass(){
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	token, err := suite.jwtManager.CreateIdToken(&user, "http://localhost", "test-client", "test-nonce", 10*time.Second)
+	suite.Require().NoError(err)
+	claims, err := suite.jwtManager.ParseTokenClaims(token)
+	suite.Require().NoError(err)
+	suite.Equal("http://localhost", claims["iss"].(string))
+	suite.Equal("test-client", claims["aud"].(string))
+	suite.Equal(user.UUID, claims["sub"].(string))
+	suite.Equal(user.Email, claims["email"].(string))
+	suite.Equal("test-nonce", claims["nonce"].(string))
+}
+
+func (suite *testSuite) Test_CreateIdTokenEmptyAudience(){
+	user := models.User{
+		Email: "test@test.test",
+		UUID: uuid.NewString(),
+	}
+	token, err := suite.jwtManager.CreateIdToken(&user, "http://localhost", "", "", 10*time.Second)
+	suite.Require().Error(err)
+	suite.Require().Empty(token)
+}
+
+func (suite *testSuite) Test_CreateRefreshUnique(){
+	first, err := suite.jwtManager.CreateRefresh()
+	suite.Require().NoError(err)
+	second, err := suite.jwtManager.CreateRefresh()
+	suite.Require().NoError(err)
+	suite.NotEqual(first, second)
+}
@@ -0,0 +1,129 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms.
+const (
+	AlgorithmHS512 = "HS512"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const minRSAKeyBits = 2048
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	// retireAt is zero for keys which are never retired.
+	retireAt time.Time
+}
+
+func newHMACKey(secret string) *signingKey {
+	key := &signingKey{
+		method:    jwt.SigningMethodHS512,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	key.kid = keyId(key)
+	return key
+}
+
+// loadSigningKey reads PEM encoded private key of the algorithm.
+// Verification key is derived from the private one.
+func loadSigningKey(algorithm, privateKeyPath string) (*signingKey, error) {
+	if privateKeyPath == "" {
+		return nil, fmt.Errorf("%w: private key path", ErrEmptyValue)
+	}
+	pemData, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLoadKey, err.Error())
+	}
+	return parseSigningKey(algorithm, pemData)
+}
+
+func parseSigningKey(algorithm string, pemData []byte) (*signingKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrLoadKey, err.Error())
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%w: rsa key must be at least %d bits", ErrLoadKey, minRSAKeyBits)
+		}
+		return newSigningKey(jwt.SigningMethodRS256, key), nil
+	case AlgorithmES256:
+		key, err := jwt.ParseECPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrLoadKey, err.Error())
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ES256 requires P-256 key", ErrLoadKey)
+		}
+		return newSigningKey(jwt.SigningMethodES256, key), nil
+	case AlgorithmEdDSA:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrLoadKey, err.Error())
+		}
+		return newSigningKey(jwt.SigningMethodEdDSA, key.(crypto.Signer)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+}
+
+func newSigningKey(method jwt.SigningMethod, signer crypto.Signer) *signingKey {
+	key := &signingKey{
+		method:    method,
+		signKey:   signer,
+		verifyKey: signer.Public(),
+	}
+	key.kid = keyId(key)
+	return key
+}
+
+// generateSigningKey creates a new random key of the algorithm.
+// Shared secrets cannot be generated, because consumers have to know them.
+func generateSigningKey(algorithm string) (*signingKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(jwt.SigningMethodRS256, key), nil
+	case AlgorithmES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(jwt.SigningMethodES256, key), nil
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(jwt.SigningMethodEdDSA, key), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRotationUnsupported, algorithm)
+	}
+}
+
+func (k *signingKey) retired(now time.Time) bool {
+	return !k.retireAt.IsZero() && now.After(k.retireAt)
+}
@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// keySet holds the active signing key, previous keys
+// which are still used to verify already issued tokens
+// and the next key which is published before it signs tokens.
+type keySet struct {
+	mu       sync.RWMutex
+	active   *signingKey
+	previous []*signingKey
+	next     *signingKey
+}
+
+func newKeySet(active *signingKey, previous ...*signingKey) *keySet {
+	return &keySet{
+		active:   active,
+		previous: previous,
+	}
+}
+
+func (ks *keySet) signing() *signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// verification finds the key by kid header.
+// Tokens without kid were issued before key ids were introduced,
+// so they are verified with the active key.
+func (ks *keySet) verification(kid string) (*signingKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if kid == "" || kid == ks.active.kid {
+		return ks.active, true
+	}
+	now := time.Now()
+	for _, key := range ks.previous {
+		if key.kid == kid && !key.retired(now) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// publish sets the key which becomes active on the next rotation.
+func (ks *keySet) publish(next *signingKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.next = next
+}
+
+// published returns the key set by publish, if any.
+func (ks *keySet) published() *signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.next
+}
+
+// rotate makes next key active. The previous active key is kept
+// for verification during retention, expired ones are dropped.
+func (ks *keySet) rotate(next *signingKey, retention time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.next == next {
+		ks.next = nil
+	}
+	now := time.Now()
+	previous := ks.active
+	previous.retireAt = now.Add(retention)
+	keys := []*signingKey{previous}
+	for _, key := range ks.previous {
+		if !key.retired(now) {
+			keys = append(keys, key)
+		}
+	}
+	ks.active = next
+	ks.previous = keys
+}
+
+// verificationKeys returns active key, not retired previous keys and published next key.
+func (ks *keySet) verificationKeys() []*signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	now := time.Now()
+	keys := []*signingKey{ks.active}
+	if ks.next != nil {
+		keys = append(keys, ks.next)
+	}
+	for _, key := range ks.previous {
+		if !key.retired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
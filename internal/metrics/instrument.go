@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/app"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+)
+
+type instrumentedAuth struct {
+	app.Auth
+	m *Metrics
+}
+
+// InstrumentAuth counts results of auth operations and issued tokens.
+func (m *Metrics) InstrumentAuth(auth app.Auth) *instrumentedAuth {
+	return &instrumentedAuth{
+		Auth: auth,
+		m: m,
+	}
+}
+
+func (a *instrumentedAuth) observe(operation string, err error) {
+	a.m.operations.WithLabelValues(operation, errorClass(err)).Inc()
+}
+
+func (a *instrumentedAuth) RegisterUser(ctx context.Context, email, password string) (uuid string, err error) {
+	uuid, err = a.Auth.RegisterUser(ctx, email, password)
+	a.observe("register_user", err)
+	return
+}
+
+func (a *instrumentedAuth) Login(ctx context.Context, email, password, device, nonce string) (pair *models.TokenPair, err error) {
+	pair, err = a.Auth.Login(ctx, email, password, device, nonce)
+	a.observe("login", err)
+	if err == nil {
+		a.m.tokensIssued.WithLabelValues("login").Inc()
+	}
+	return
+}
+
+func (a *instrumentedAuth) CreateTokenPair(ctx context.Context, uuid, device, nonce string) (pair *models.TokenPair, err error) {
+	pair, err = a.Auth.CreateTokenPair(ctx, uuid, device, nonce)
+	a.observe("create_token_pair", err)
+	if err == nil {
+		a.m.tokensIssued.WithLabelValues("create_token_pair").Inc()
+	}
+	return
+}
+
+func (a *instrumentedAuth) RefreshToken(ctx context.Context, accessToken, refreshToken string) (newToken, newRefresh string, err error) {
+	newToken, newRefresh, err = a.Auth.RefreshToken(ctx, accessToken, refreshToken)
+	a.observe("refresh_token", err)
+	if err == nil {
+		a.m.tokensIssued.WithLabelValues("refresh_token").Inc()
+	}
+	return
+}
+
+func (a *instrumentedAuth) RevokeToken(ctx context.Context, token, tokenTypeHint string) (err error) {
+	err = a.Auth.RevokeToken(ctx, token, tokenTypeHint)
+	a.observe("revoke_token", err)
+	return
+}
+
+func (a *instrumentedAuth) LogoutAll(ctx context.Context, accessToken string) (err error) {
+	err = a.Auth.LogoutAll(ctx, accessToken)
+	a.observe("logout_all", err)
+	return
+}
+
+func (a *instrumentedAuth) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (res *models.IntrospectionResponse, err error) {
+	res, err = a.Auth.IntrospectToken(ctx, token, tokenTypeHint)
+	a.observe("introspect_token", err)
+	return
+}
+
+func (a *instrumentedAuth) UnlockUser(ctx context.Context, uuid string) (err error) {
+	err = a.Auth.UnlockUser(ctx, uuid)
+	a.observe("unlock_user", err)
+	return
+}
+
+type instrumentedRepo struct {
+	service.UserRepo
+	m *Metrics
+}
+
+// InstrumentRepo measures latency of storage operations.
+func (m *Metrics) InstrumentRepo(repo service.UserRepo) *instrumentedRepo {
+	return &instrumentedRepo{
+		UserRepo: repo,
+		m: m,
+	}
+}
+
+func (m *Metrics) observeStorage(operation string, start time.Time, err error) {
+	m.storageDuration.WithLabelValues(operation, errorClass(err)).Observe(time.Since(start).Seconds())
+}
+
+func (r *instrumentedRepo) SaveUser(ctx context.Context, user *models.User) (err error) {
+	start := time.Now()
+	err = r.UserRepo.SaveUser(ctx, user)
+	r.m.observeStorage("save_user", start, err)
+	return
+}
+
+func (r *instrumentedRepo) GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error) {
+	start := time.Now()
+	user, err = r.UserRepo.GetUserByUUID(ctx, uuid)
+	r.m.observeStorage("get_user_by_uuid", start, err)
+	return
+}
+
+func (r *instrumentedRepo) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	start := time.Now()
+	user, err = r.UserRepo.GetUserByEmail(ctx, email)
+	r.m.observeStorage("get_user_by_email", start, err)
+	return
+}
+
+func (r *instrumentedRepo) UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error) {
+	start := time.Now()
+	err = r.UserRepo.UpdatePasswordHash(ctx, uuid, passwordHash)
+	r.m.observeStorage("update_password_hash", start, err)
+	return
+}
+
+func (r *instrumentedRepo) SaveSession(ctx context.Context, session *models.Session) (err error) {
+	start := time.Now()
+	err = r.UserRepo.SaveSession(ctx, session)
+	r.m.observeStorage("save_session", start, err)
+	return
+}
+
+func (r *instrumentedRepo) GetSession(ctx context.Context, sessionId string) (session *models.Session, err error) {
+	start := time.Now()
+	session, err = r.UserRepo.GetSession(ctx, sessionId)
+	r.m.observeStorage("get_session", start, err)
+	return
+}
+
+func (r *instrumentedRepo) GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error) {
+	start := time.Now()
+	session, err = r.UserRepo.GetSessionBySelector(ctx, selector)
+	r.m.observeStorage("get_session_by_selector", start, err)
+	return
+}
+
+func (r *instrumentedRepo) UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error) {
+	start := time.Now()
+	err = r.UserRepo.UpdateSession(ctx, session, expectedGeneration)
+	r.m.observeStorage("update_session", start, err)
+	return
+}
+
+func (r *instrumentedRepo) RevokeSession(ctx context.Context, sessionId string) (err error) {
+	start := time.Now()
+	err = r.UserRepo.RevokeSession(ctx, sessionId)
+	r.m.observeStorage("revoke_session", start, err)
+	return
+}
+
+func (r *instrumentedRepo) RevokeUserSessions(ctx context.Context, uuid string) (err error) {
+	start := time.Now()
+	err = r.UserRepo.RevokeUserSessions(ctx, uuid)
+	r.m.observeStorage("revoke_user_sessions", start, err)
+	return
+}
+
+func (r *instrumentedRepo) RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error) {
+	start := time.Now()
+	attempts, err = r.UserRepo.RecordFailedAttempt(ctx, uuid, now, notBefore)
+	r.m.observeStorage("record_failed_attempt", start, err)
+	return
+}
+
+func (r *instrumentedRepo) LockUser(ctx context.Context, uuid string, until int64) (err error) {
+	start := time.Now()
+	err = r.UserRepo.LockUser(ctx, uuid, until)
+	r.m.observeStorage("lock_user", start, err)
+	return
+}
+
+func (r *instrumentedRepo) ResetFailedAttempts(ctx context.Context, uuid string) (err error) {
+	start := time.Now()
+	err = r.UserRepo.ResetFailedAttempts(ctx, uuid)
+	r.m.observeStorage("reset_failed_attempts", start, err)
+	return
+}
+
+type instrumentedDenylist struct {
+	service.TokenDenylist
+	m *Metrics
+}
+
+// InstrumentDenylist measures latency of denylist operations.
+func (m *Metrics) InstrumentDenylist(denylist service.TokenDenylist) *instrumentedDenylist {
+	return &instrumentedDenylist{
+		TokenDenylist: denylist,
+		m: m,
+	}
+}
+
+func (d *instrumentedDenylist) Deny(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	start := time.Now()
+	err = d.TokenDenylist.Deny(ctx, jti, expiresAt)
+	d.m.observeStorage("deny", start, err)
+	return
+}
+
+func (d *instrumentedDenylist) IsDenied(ctx context.Context, jti string) (denied bool, err error) {
+	start := time.Now()
+	denied, err = d.TokenDenylist.IsDenied(ctx, jti)
+	d.m.observeStorage("is_denied", start, err)
+	return
+}
+
+type instrumentedHasher struct {
+	service.Hasher
+	m *Metrics
+}
+
+// InstrumentHasher measures time of hashing and verifying passwords,
+// the algorithm is taken from the encoded hash.
+func (m *Metrics) InstrumentHasher(hasher service.Hasher) *instrumentedHasher {
+	return &instrumentedHasher{
+		Hasher: hasher,
+		m: m,
+	}
+}
+
+func (h *instrumentedHasher) Hash(secret string) (encoded string, err error) {
+	start := time.Now()
+	encoded, err = h.Hasher.Hash(secret)
+	h.m.hashDuration.WithLabelValues("hash", hashAlgorithm(encoded)).Observe(time.Since(start).Seconds())
+	return
+}
+
+func (h *instrumentedHasher) Verify(secret, encoded string) (ok bool, err error) {
+	start := time.Now()
+	ok, err = h.Hasher.Verify(secret, encoded)
+	h.m.hashDuration.WithLabelValues("verify", hashAlgorithm(encoded)).Observe(time.Since(start).Seconds())
+	return
+}
+
+// hashAlgorithm recognizes the algorithm by prefix of the encoded hash.
+func hashAlgorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return "argon2id"
+	case strings.HasPrefix(encoded, "$2"):
+		return "bcrypt"
+	default:
+		return "unknown"
+	}
+}
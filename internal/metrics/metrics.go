@@ -0,0 +1,151 @@
+// Package metrics collects prometheus metrics of the service
+// by wrapping its components and serves them on the admin listener.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	operations      *prometheus.CounterVec
+	tokensIssued    *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+	hashDuration    *prometheus.HistogramVec
+}
+
+// New creates metrics registered in their own registry together
+// with go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "http_requests_total",
+			Help: "Number of handled http requests by route and status.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "http_request_duration_seconds",
+			Help: "Time of handling http requests by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "operations_total",
+			Help: "Number of auth operations by result, result is ok or the class of the error.",
+		}, []string{"operation", "result"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name: "tokens_issued_total",
+			Help: "Number of issued token pairs by operation.",
+		}, []string{"operation"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "storage_operation_duration_seconds",
+			Help: "Time of storage operations by result.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "result"}),
+		hashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name: "password_hash_duration_seconds",
+			Help: "Time of hashing and verifying passwords by algorithm.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "algorithm"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.operations,
+		m.tokensIssued,
+		m.storageDuration,
+		m.hashDuration,
+	)
+	return m
+}
+
+// ObserveRequest is called for every request matched by the router.
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RunServer serves metrics on the listener from cfg until ctx is done.
+func (m *Metrics) RunServer(ctx context.Context, cfg config.MetricsConfig, log *slog.Logger) {
+	path := cfg.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, m.Handler())
+	srv := &http.Server{
+		Handler: mux,
+		Addr:    fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	log.Info("starting metrics listening", slog.String("addres", srv.Addr), slog.String("path", path))
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("metrics server stopped", slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// errorClasses keep the result label small, the first matching class is used.
+var errorClasses = []struct {
+	err   error
+	class string
+}{
+	{service.ErrInvalidCredentials, "invalid_credentials"},
+	{service.ErrValidAccess, "invalid_token"},
+	{service.ErrValidRefresh, "invalid_token"},
+	{service.ErrRefreshReused, "token_reused"},
+	{service.ErrRefreshConflict, "conflict"},
+	{service.ErrAccountLocked, "locked"},
+	{service.ErrPasswordPolicy, "validation"},
+	{storage.ErrUserExist, "user_exists"},
+	{storage.ErrUserNotFound, "not_found"},
+	{storage.ErrSessionNotFound, "not_found"},
+	{storage.ErrSessionConflict, "conflict"},
+	{context.DeadlineExceeded, "timeout"},
+	{context.Canceled, "canceled"},
+}
+
+func errorClass(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	for _, known := range errorClasses {
+		if errors.Is(err, known.err) {
+			return known.class
+		}
+	}
+	return "error"
+}
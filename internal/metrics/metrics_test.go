@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EwvwGeN/medods_assignment/internal/app"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/stretchr/testify/suite"
+)
+
+// loginAuth answers login with the preset error, other methods are not used.
+type loginAuth struct {
+	app.Auth
+	err error
+}
+
+func (a *loginAuth) Login(ctx context.Context, email, password, device, nonce string) (*models.TokenPair, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &models.TokenPair{}, nil
+}
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) scrape(m *Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	suite.Equal(http.StatusOK, recorder.Code)
+	return recorder.Body.String()
+}
+
+func (suite *testSuite) Test_ErrorClass(){
+	suite.Equal("ok", errorClass(nil))
+	suite.Equal("invalid_credentials", errorClass(fmt.Errorf("failed login: %w", service.ErrInvalidCredentials)))
+	suite.Equal("timeout", errorClass(fmt.Errorf("failed login: %w", context.DeadlineExceeded)))
+	suite.Equal("error", errorClass(fmt.Errorf("unexpected")))
+}
+
+func (suite *testSuite) Test_HashAlgorithm(){
+	suite.Equal("argon2id", hashAlgorithm("$argon2id$v=19$m=65536,t=3,p=2$salt$hash"))
+	suite.Equal("bcrypt", hashAlgorithm("$2a$10$hash"))
+	suite.Equal("unknown", hashAlgorithm("plain"))
+}
+
+func (suite *testSuite) Test_InstrumentAuth(){
+	m := New()
+	ctx := context.Background()
+	_, err := m.InstrumentAuth(&loginAuth{}).Login(ctx, "user@example.com", "password", "", "")
+	suite.NoError(err)
+	_, err = m.InstrumentAuth(&loginAuth{err: service.ErrInvalidCredentials}).Login(ctx, "user@example.com", "password", "", "")
+	suite.ErrorIs(err, service.ErrInvalidCredentials)
+	m.ObserveRequest("/api/login", http.MethodPost, http.StatusOK, 0)
+
+	body := suite.scrape(m)
+	suite.Contains(body, `auth_operations_total{operation="login",result="ok"} 1`)
+	suite.Contains(body, `auth_operations_total{operation="login",result="invalid_credentials"} 1`)
+	suite.Contains(body, `auth_tokens_issued_total{operation="login"} 1`)
+	suite.Contains(body, `auth_http_requests_total{method="POST",route="/api/login",status="200"} 1`)
+	suite.Contains(body, "go_goroutines")
+}
@@ -0,0 +1,74 @@
+// Package ratelimit limits requests with token buckets kept in a shared store.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+)
+
+type Store interface {
+	// TakeToken takes a token from the bucket of key, which is refilled with rate
+	// tokens per second up to burst. retryAfter is time until the next token when
+	// the bucket is empty.
+	TakeToken(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type Limit struct {
+	// Rate is number of tokens added per second.
+	Rate  float64
+	Burst int
+}
+
+func LimitFromConfig(cfg config.LimitConfig) Limit {
+	if cfg.Requests <= 0 || cfg.Interval <= 0 {
+		return Limit{}
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Requests
+	}
+	return Limit{
+		Rate: float64(cfg.Requests) / cfg.Interval.Seconds(),
+		Burst: burst,
+	}
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Rule is a limit applied to the bucket of key.
+type Rule struct {
+	Key   string
+	Limit Limit
+}
+
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		store: store,
+	}
+}
+
+// Allow takes a token for every enabled rule in order and stops on the first
+// empty bucket, so denied request does not spend tokens of the next rules.
+func (l *Limiter) Allow(ctx context.Context, rules ...Rule) (retryAfter time.Duration, allowed bool, err error) {
+	for _, rule := range rules {
+		if !rule.Limit.Enabled() {
+			continue
+		}
+		allowed, retryAfter, err = l.store.TakeToken(ctx, rule.Key, rule.Limit.Rate, rule.Limit.Burst)
+		if err != nil {
+			return 0, false, err
+		}
+		if !allowed {
+			return retryAfter, false, nil
+		}
+	}
+	return 0, true, nil
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/stretchr/testify/suite"
+)
+
+// countingStore allows only keys from the allowed set and remembers taken keys.
+type countingStore struct {
+	allowed map[string]bool
+	taken   []string
+}
+
+func (s *countingStore) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	s.taken = append(s.taken, key)
+	if s.allowed[key] {
+		return true, 0, nil
+	}
+	return false, time.Second, nil
+}
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) Test_LimitFromConfig(){
+	suite.Equal(Limit{Rate: 0.5, Burst: 3}, LimitFromConfig(config.LimitConfig{Requests: 30, Interval: time.Minute, Burst: 3}))
+	suite.Equal(Limit{Rate: 0.5, Burst: 30}, LimitFromConfig(config.LimitConfig{Requests: 30, Interval: time.Minute}))
+	suite.False(LimitFromConfig(config.LimitConfig{Interval: time.Minute}).Enabled())
+}
+
+func (suite *testSuite) Test_AllowStopsOnFirstDenied(){
+	store := &countingStore{allowed: map[string]bool{"ip": true}}
+	limiter := NewLimiter(store)
+	limit := Limit{Rate: 1, Burst: 1}
+
+	retryAfter, allowed, err := limiter.Allow(context.Background(),
+		Rule{Key: "ip", Limit: limit},
+		Rule{Key: "disabled"},
+		Rule{Key: "email", Limit: limit},
+		Rule{Key: "uuid", Limit: limit},
+	)
+	suite.Require().NoError(err)
+	suite.False(allowed)
+	suite.Equal(time.Second, retryAfter)
+	suite.Equal([]string{"ip", "email"}, store.taken)
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// validateAccess checks signature and expiration of the access token
+// and that the token was not revoked before.
+func (a *Auth) validateAccess(ctx context.Context, log *slog.Logger, accessToken string) (jwt.MapClaims, error) {
+	tokenClaims, err := a.jwtManager.ParseTokenClaims(accessToken)
+	if err != nil {
+		log.Info("not valid access token", slog.String("error", err.Error()))
+		return nil, ErrValidAccess
+	}
+	return a.checkDenied(ctx, log, tokenClaims)
+}
+
+// validateBinding checks access token passed with refresh token. It is usually
+// expired by the time of refresh, so only signature and revocation are checked.
+func (a *Auth) validateBinding(ctx context.Context, log *slog.Logger, accessToken string) (jwt.MapClaims, error) {
+	tokenClaims, err := a.jwtManager.ParseTokenClaimsWithoutExpiry(accessToken)
+	if err != nil {
+		log.Info("not valid access token", slog.String("error", err.Error()))
+		return nil, ErrValidAccess
+	}
+	return a.checkDenied(ctx, log, tokenClaims)
+}
+
+func (a *Auth) checkDenied(ctx context.Context, log *slog.Logger, tokenClaims jwt.MapClaims) (jwt.MapClaims, error) {
+	jti, ok := tokenClaims["jti"].(string)
+	if !ok || jti == "" {
+		log.Info("cant get jti from token claims")
+		return nil, ErrValidAccess
+	}
+	denied, err := a.denylist.IsDenied(ctx, jti)
+	if err != nil {
+		log.Error("failed to check token denylist", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %w", ErrCheckDenylist, err)
+	}
+	if denied {
+		log.Info("access token is revoked", slog.String("jti", jti))
+		return nil, ErrValidAccess
+	}
+	return tokenClaims, nil
+}
+
+// denyAccess puts the access token into denylist until it expires by itself.
+func (a *Auth) denyAccess(ctx context.Context, log *slog.Logger, tokenClaims jwt.MapClaims) error {
+	jti, ok := tokenClaims["jti"].(string)
+	if !ok || jti == "" {
+		return nil
+	}
+	exp, ok := tokenClaims["exp"].(float64)
+	if !ok {
+		return nil
+	}
+	err := a.denylist.Deny(ctx, jti, time.Unix(int64(exp), 0))
+	if err != nil {
+		log.Error("failed to deny access token", slog.String("jti", jti), slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %w", ErrRevokeAccess, err)
+	}
+	return nil
+}
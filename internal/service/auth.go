@@ -2,154 +2,367 @@ package service
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/EwvwGeN/medods_assignment/internal/config"
 	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
 	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
 	"github.com/golang-jwt/jwt"
 	guuid "github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/EwvwGeN/medods_assignment/internal/service")
+
 type Auth struct {
 	log *slog.Logger
 	userRepo UserRepo
 	jwtManager JwtManager
+	denylist TokenDenylist
+	hasher Hasher
+	digester RefreshDigester
+	// dummyHash is verified when there is nothing to verify against,
+	// so the response time does not disclose whether the user exists.
+	dummyHash string
 	tokenTTL time.Duration
 	refreshTTL time.Duration
-
+	oidc config.OidcConfig
+	timeouts config.TimeoutsConfig
+	lockout config.LockoutConfig
 }
 
 type UserRepo interface {
-	SaveUser(ctx context.Context, email, uuid string) (err error)
-	SaveRefreshToken(ctx context.Context, uuid, refresh string, refreshTTL time.Duration) (err error)
+	SaveUser(ctx context.Context, user *models.User) (err error)
 	GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error)
+	GetUserByEmail(ctx context.Context, email string) (user *models.User, err error)
+	UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error)
+	SaveSession(ctx context.Context, session *models.Session) (err error)
+	GetSession(ctx context.Context, sessionId string) (session *models.Session, err error)
+	// GetSessionBySelector finds session by selector of its current
+	// or already rotated refresh token.
+	GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error)
+	// UpdateSession replaces the session only if stored one is not revoked
+	// and still has expectedGeneration, so only one of concurrent rotations wins.
+	// It returns storage.ErrSessionConflict when the check fails.
+	UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error)
+	RevokeSession(ctx context.Context, sessionId string) (err error)
+	RevokeUserSessions(ctx context.Context, uuid string) (err error)
+	// RecordFailedAttempt increments failed attempts of the user and returns their number.
+	// Attempts made before notBefore are forgotten, so the count starts from 1.
+	RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error)
+	// LockUser locks the user until the time, the lock is only extended.
+	LockUser(ctx context.Context, uuid string, until int64) (err error)
+	// ResetFailedAttempts forgets failed attempts and removes the lock.
+	ResetFailedAttempts(ctx context.Context, uuid string) (err error)
+}
+
+type TokenDenylist interface {
+	Deny(ctx context.Context, jti string, expiresAt time.Time) (err error)
+	IsDenied(ctx context.Context, jti string) (denied bool, err error)
+}
+
+type Hasher interface {
+	Hash(secret string) (encoded string, err error)
+	Verify(secret, encoded string) (ok bool, err error)
+	NeedsRehash(encoded string) bool
+}
+
+type RefreshDigester interface {
+	Digest(secret string) (digest string)
+	Verify(secret, digest string) (ok bool)
 }
 
 type JwtManager interface {
-	CreateJwt(user *models.User, ttl time.Duration) (token string, err error)
+	CreateJwt(user *models.User, sessionId string, ttl time.Duration) (token string, err error)
+	CreateIdToken(user *models.User, issuer, audience, nonce string, ttl time.Duration) (token string, err error)
 	CreateRefresh() (refresh string, err error)
 	ParseTokenClaims(token string) (jwt.MapClaims, error) 
+	// ParseTokenClaimsWithoutExpiry checks the signature, but not the expiration of the token.
+	ParseTokenClaimsWithoutExpiry(token string) (jwt.MapClaims, error)
+	Algorithm() string
+	JWKS() models.JWKS
 }
 
-func NewAuth(ctx context.Context, log *slog.Logger, userRepo UserRepo, jwtManager JwtManager, tokenttl, refreshttl time.Duration) *Auth {
+func NewAuth(ctx context.Context, log *slog.Logger, userRepo UserRepo, jwtManager JwtManager, denylist TokenDenylist, hasher Hasher, digester RefreshDigester, tokenttl, refreshttl time.Duration, oidc config.OidcConfig, timeouts config.TimeoutsConfig, lockout config.LockoutConfig) *Auth {
+	if oidc.IdTokenTTL == 0 {
+		oidc.IdTokenTTL = tokenttl
+	}
+	dummyHash, err := hasher.Hash(guuid.NewString())
+	if err != nil {
+		log.Error("failed to generate dummy hash", slog.String("error", err.Error()))
+	}
 	return &Auth{
 		log: log,
 		userRepo: userRepo,
 		jwtManager: jwtManager,
+		denylist: denylist,
+		hasher: hasher,
+		digester: digester,
+		dummyHash: dummyHash,
 		tokenTTL: tokenttl,
 		refreshTTL: refreshttl,
+		oidc: oidc,
+		timeouts: timeouts,
+		lockout: lockout,
+	}
+}
+
+// withTimeout limits ctx of the operation by its configured timeout.
+func (a *Auth) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = a.timeouts.Default
 	}
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (a *Auth) RegisterUser(email string) (uuid string, err error) {
-	log := a.log.With(slog.String("auth.method", "register_user"))
+func (a *Auth) RegisterUser(ctx context.Context, email, password string) (uuid string, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.RegisterUser")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "register_user"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Register)
+	defer cancel()
+	if err = checkPasswordPolicy(password); err != nil {
+		log.Info("failed register user", slog.String("error", err.Error()))
+		return "", fmt.Errorf("failed register user: %w", err)
+	}
 	uuid = guuid.New().String()
 	if uuid == "" {
 		log.Error(ErrCreateUUID.Error())
 		return "", fmt.Errorf("failed register user: %w", ErrCreateUUID)
 	}
-	err = a.userRepo.SaveUser(context.Background(), email, uuid)
+	passwordHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.String("error", err.Error()))
+		return "", fmt.Errorf("failed register user: %w", err)
+	}
+	err = a.userRepo.SaveUser(ctx, &models.User{
+		Email: email,
+		UUID: uuid,
+		PasswordHash: passwordHash,
+	})
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExist) {
 			log.Info("failed register user", slog.String("error", storage.ErrUserExist.Error()))
 			return "", fmt.Errorf("failed register user: %w", storage.ErrUserExist)
 		}
 		log.Warn("failed register user", slog.String("uuid", uuid), slog.String("error", err.Error()))
-		return "", fmt.Errorf("failed register user: %w", ErrSaveUser)
+		return "", fmt.Errorf("failed register user: %w: %w", ErrSaveUser, err)
 	}
 	return
 }
 
-func (a *Auth) CreateTokenPair(uuid string) (token, refresh string, err error) {
-	log := a.log.With(slog.String("auth.method", "create_token_pair"))
-	user, err:= a.userRepo.GetUserByUUID(context.Background(), uuid)
+func (a *Auth) CreateTokenPair(ctx context.Context, uuid, device, nonce string) (pair *models.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.CreateTokenPair")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "create_token_pair"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.CreateTokenPair)
+	defer cancel()
+	user, err:= a.userRepo.GetUserByUUID(ctx, uuid)
 	log.Debug("got user", slog.Any("user", user))
 	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("failed create token pair", slog.String("error", storage.ErrUserNotFound.Error()))
+			return nil, fmt.Errorf("failed create token pair: %w", storage.ErrUserNotFound)
+		}
 		log.Warn(ErrGetUserUUID.Error(), slog.String("error", err.Error()))
-		return "", "", fmt.Errorf("failed create token pair: %w", ErrGetUserUUID)
+		return nil, fmt.Errorf("failed create token pair: %w: %w", ErrGetUserUUID, err)
+	}
+	pair, err = a.issueTokenPair(ctx, log, user, device, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed create token pair: %w", err)
 	}
-	token, err = a.jwtManager.CreateJwt(user, a.tokenTTL)
+	return pair, nil
+}
+
+// issueTokenPair starts a new session of the user.
+func (a *Auth) issueTokenPair(ctx context.Context, log *slog.Logger, user *models.User, device, nonce string) (pair *models.TokenPair, err error) {
+	sessionId := guuid.New().String()
+	token, err := a.jwtManager.CreateJwt(user, sessionId, a.tokenTTL)
 	if err != nil {
 		log.Error(ErrCreateJWT.Error(), slog.String("error", err.Error()))
-		return "", "", fmt.Errorf("failed create token pair: %w", ErrCreateJWT)
+		return nil, ErrCreateJWT
 	}
-	refresh, err = a.jwtManager.CreateRefresh()
+	idToken, err := a.jwtManager.CreateIdToken(user, a.oidc.Issuer, a.oidc.Audience, nonce, a.oidc.IdTokenTTL)
+	if err != nil {
+		log.Error(ErrCreateJWT.Error(), slog.String("error", err.Error()))
+		return nil, ErrCreateJWT
+	}
+	refresh, selector, digest, err := a.newRefresh()
 	if err != nil {
 		log.Error(ErrCreateRefresh.Error(), slog.String("error", err.Error()))
-		return "", "", fmt.Errorf("failed create token pair: %w", ErrCreateRefresh)
+		return nil, ErrCreateRefresh
 	}
-	refreshHash, err := bcrypt.GenerateFromPassword([]byte(refresh), bcrypt.DefaultCost)
+	now := time.Now()
+	err = a.userRepo.SaveSession(ctx, &models.Session{
+		Id: sessionId,
+		UUID: user.UUID,
+		Device: device,
+		RefreshSelector: selector,
+		RefreshDigest: digest,
+		UsedRefreshes: []models.UsedRefresh{},
+		CreatedAt: now.Unix(),
+		LastUsedAt: now.Unix(),
+		ExpiresAt: now.Add(a.refreshTTL).Unix(),
+	})
 	if err != nil {
-		log.Error("failed to generate refresh hash", slog.String("error", err.Error()))
-		return "", "", fmt.Errorf("failed create token pair: %w", err)
+		log.Error("failed to save session", slog.String("error", err.Error()))
+		return nil, err
 	}
-	log.Debug("creted refresh hash", slog.String("hash", string(refreshHash)))
-	err = a.userRepo.SaveRefreshToken(context.Background(), user.UUID, string(refreshHash), a.refreshTTL)
+	return &models.TokenPair{
+		AccessToken: token,
+		RefreshToken: refresh,
+		IdToken: idToken,
+	}, nil
+}
+
+// RefreshTokenOwner returns uuid of the user the refresh token was issued to.
+// The verifier is not checked, so requests guessing verifiers of one session
+// can be rate limited by its owner before the refresh is attempted.
+func (a *Auth) RefreshTokenOwner(ctx context.Context, refreshToken string) (uuid string, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.RefreshTokenOwner")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "refresh_token_owner"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Refresh)
+	defer cancel()
+	selector, _, err := decodeRefresh(refreshToken)
 	if err != nil {
-		log.Error("failed to save refresh token")
-		return "", "", fmt.Errorf("failed create token pair: %w", err)
+		return "", fmt.Errorf("failed get refresh token owner: %w", err)
 	}
-	refresh = base64.StdEncoding.EncodeToString([]byte(refresh))
-	return
+	session, err := a.userRepo.GetSessionBySelector(ctx, selector)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return "", fmt.Errorf("failed get refresh token owner: %w", ErrValidRefresh)
+		}
+		log.Warn(ErrGetSession.Error(), slog.String("error", err.Error()))
+		return "", fmt.Errorf("failed get refresh token owner: %w: %w", ErrGetSession, err)
+	}
+	return session.UUID, nil
 }
 
-func (a *Auth) RefreshToken(accessToken, refreshToken string) (newToken, newRefresh string, err error) {
-	log := a.log.With(slog.String("auth.method", "refresh_token"))
+// RefreshToken rotates refresh token of the session. Access token is optional,
+// when it is passed it must belong to the same session, but may be expired.
+func (a *Auth) RefreshToken(ctx context.Context, accessToken, refreshToken string) (newToken, newRefresh string, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.RefreshToken")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "refresh_token"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Refresh)
+	defer cancel()
 	log.Debug("start refreshing", slog.String("access_token", accessToken), slog.String("refresh_token", refreshToken))
-	tokenClaims, err := a.jwtManager.ParseTokenClaims(accessToken)
+	var uuid, tokenSessionId string
+	if accessToken != "" {
+		tokenClaims, err := a.validateBinding(ctx, log, accessToken)
+		if err != nil {
+			return "", "", fmt.Errorf("failed refresh token: %w", err)
+		}
+		var ok bool
+		if uuid, ok = tokenClaims["uuid"].(string); !ok {
+			log.Info("cant get uuid from token claims")
+			return "", "", fmt.Errorf("failed refresh token: %w", ErrValidAccess)
+		}
+		if tokenSessionId, ok = tokenClaims["sid"].(string); !ok {
+			log.Info("cant get session id from token claims")
+			return "", "", fmt.Errorf("failed refresh token: %w", ErrValidAccess)
+		}
+	}
+	queryTime := time.Now()
+	session, current, err := a.findRefreshSession(ctx, log, refreshToken)
+	log.Debug("got session by refresh token", slog.Any("session", session))
 	if err != nil {
-		log.Info("not valid access token", slog.String("error", err.Error()))
+		log.Info("cant find session of refresh token", slog.String("error", err.Error()))
+		if session != nil {
+			a.recordFailure(ctx, log, session.UUID)
+		}
 		return "", "", fmt.Errorf("failed refresh token: %w", err)
 	}
-	uuid, ok := tokenClaims["uuid"]
-	if !ok {
-		log.Info("cant get uuid from token claims")
-		return "", "", fmt.Errorf("failed refresh token: %w", ErrValidAccess)
-	}
-	queryTime := time.Now().Unix()
-	user, err := a.userRepo.GetUserByUUID(context.Background(), uuid.(string))
-	log.Debug("gor user by uuid", slog.Any("user", user))
-	if err != nil {
-		log.Warn(ErrGetUserUUID.Error(), slog.String("error", err.Error()))
-		return "", "", fmt.Errorf("failed refresh token: %w", ErrGetUserUUID)
+	if accessToken != "" && (session.Id != tokenSessionId || session.UUID != uuid) {
+		log.Info("tokens belong to different sessions", slog.String("uuid", uuid), slog.String("session_id", session.Id))
+		a.recordFailure(ctx, log, session.UUID)
+		return "", "", fmt.Errorf("failed refresh token: %w", ErrValidRefresh)
 	}
-	refreshBytes, err := base64.StdEncoding.DecodeString(refreshToken)
-	if err != nil {
-		return "", "", ErrValidRefresh
+	// rotated token is reported as reused even when the family is already revoked
+	if !current {
+		if session.RevokedAt == 0 {
+			a.revokeFamily(ctx, log, session)
+		}
+		return "", "", fmt.Errorf("failed refresh token: %w", ErrRefreshReused)
 	}
-	refreshToken = string(refreshBytes)
-	err = bcrypt.CompareHashAndPassword([]byte(user.RefreshHash), []byte(refreshToken))
-	if err != nil {
+	if session.RevokedAt != 0 {
+		log.Info("session is revoked", slog.String("session_id", session.Id))
 		return "", "", fmt.Errorf("failed refresh token: %w", ErrValidRefresh)
 	}
-	if queryTime > user.ExpiresAt {
+	if queryTime.Unix() > session.ExpiresAt {
 		return "", "", fmt.Errorf("failed refresh token: %w", ErrValidRefresh)
 	}
-	newToken, err = a.jwtManager.CreateJwt(user, a.tokenTTL)
+	user, err := a.userRepo.GetUserByUUID(ctx, session.UUID)
+	if err != nil {
+		log.Warn(ErrGetUserUUID.Error(), slog.String("error", err.Error()))
+		return "", "", fmt.Errorf("failed refresh token: %w: %w", ErrGetUserUUID, err)
+	}
+	if err = a.checkLock(log, user.UUID, user.LockedUntil, queryTime); err != nil {
+		return "", "", fmt.Errorf("failed refresh token: %w", err)
+	}
+	newToken, err = a.jwtManager.CreateJwt(user, session.Id, a.tokenTTL)
 	if err != nil {
 		log.Error(ErrCreateJWT.Error(), slog.String("error", err.Error()))
 		return "", "", fmt.Errorf("failed refresh token: %w", ErrCreateJWT)
 	}
-	newRefresh, err = a.jwtManager.CreateRefresh()
+	newRefresh, selector, digest, err := a.newRefresh()
 	if err != nil {
 		log.Error(ErrCreateRefresh.Error(), slog.String("error", err.Error()))
 		return "", "", fmt.Errorf("failed refresh token: %w", ErrCreateRefresh)
 	}
-	newRefreshHash, err := bcrypt.GenerateFromPassword([]byte(newRefresh), bcrypt.DefaultCost)
+	generation := session.Generation
+	rotateRefresh(session, selector, digest, queryTime, a.refreshTTL)
+	err = a.userRepo.UpdateSession(ctx, session, generation)
 	if err != nil {
-		log.Error("failed to generate new refresh hash", slog.String("error", err.Error()))
+		if errors.Is(err, storage.ErrSessionConflict) {
+			log.Info("refresh token was rotated concurrently", slog.String("session_id", session.Id), slog.Int64("generation", generation))
+			return "", "", fmt.Errorf("failed refresh token: %w", ErrRefreshConflict)
+		}
+		log.Error("failed to save refresh token", slog.String("error", err.Error()))
 		return "", "", fmt.Errorf("failed refresh token: %w", err)
 	}
-	err = a.userRepo.SaveRefreshToken(context.Background(), user.UUID, string(newRefreshHash), a.refreshTTL)
+	return
+}
+
+// revokeFamily is called when already rotated refresh token is presented again.
+// It means that the token was stolen, so every token of the family is revoked.
+func (a *Auth) revokeFamily(ctx context.Context, log *slog.Logger, session *models.Session) {
+	log.Warn("refresh token reuse detected",
+		slog.String("event", "refresh_token_reuse"),
+		slog.String("uuid", session.UUID),
+		slog.String("session_id", session.Id),
+		slog.String("device", session.Device),
+		slog.Int64("current_generation", session.Generation),
+	)
+	// revocation must not be interrupted when the client goes away
+	ctx, cancel := a.withTimeout(context.WithoutCancel(ctx), a.timeouts.Revoke)
+	defer cancel()
+	if err := a.userRepo.RevokeSession(ctx, session.Id); err != nil {
+		log.Error("failed to revoke refresh token family", slog.String("session_id", session.Id), slog.String("error", err.Error()))
+	}
+}
+
+// JWKS returns public keys for verifying issued tokens.
+func (a *Auth) JWKS() models.JWKS {
+	return a.jwtManager.JWKS()
+}
+
+// verifyHash reports whether secret matches the hash.
+// Broken hashes are logged and treated as mismatch.
+func (a *Auth) verifyHash(log *slog.Logger, secret, hash string) bool {
+	ok, err := a.hasher.Verify(secret, hash)
 	if err != nil {
-		log.Error("failed to save refresh token")
-		return "", "", fmt.Errorf("failed refresh token: %w", err)
+		log.Error("failed to verify hash", slog.String("error", err.Error()))
+		return false
 	}
-	newRefresh = base64.StdEncoding.EncodeToString([]byte(newRefresh))
-	return
-}
\ No newline at end of file
+	return ok
+}
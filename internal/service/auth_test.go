@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/hasher"
+	"github.com/EwvwGeN/medods_assignment/internal/jwt"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type testSuite struct {
+	suite.Suite
+	auth *Auth
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) SetupTest() {
+	ctx := context.Background()
+	secretHasher, err := hasher.NewHasher(config.HasherConfig{
+		Algorithm: hasher.AlgorithmBcrypt,
+		BcryptCost: 4,
+	})
+	suite.Require().NoError(err)
+	suite.auth = NewAuth(ctx,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage.NewMemoryProvider(ctx, 0),
+		jwt.NewJwtManager("test_secret_key"),
+		storage.NewMemoryDenylist(ctx, 0),
+		secretHasher,
+		hasher.NewDigester("test_refresh_key"),
+		time.Minute,
+		time.Hour,
+		config.OidcConfig{Issuer: "http://localhost", Audience: "test"},
+		config.TimeoutsConfig{Default: time.Second},
+		config.LockoutConfig{Enabled: true, Threshold: 3, Window: time.Minute, BaseDuration: time.Minute, MaxDuration: time.Hour},
+	)
+}
+
+func (suite *testSuite) Test_RegisterAndLogin(){
+	uuid, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(uuid)
+	_, err = suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.ErrorIs(err, storage.ErrUserExist)
+
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	suite.NotEmpty(pair.AccessToken)
+	suite.NotEmpty(pair.RefreshToken)
+	suite.NotEmpty(pair.IdToken)
+
+	_, err = suite.auth.Login(context.Background(), "test@test.test", "wrong_password", "laptop", "")
+	suite.ErrorIs(err, ErrInvalidCredentials)
+	_, err = suite.auth.Login(context.Background(), "missing@test.test", "test_password", "laptop", "")
+	suite.ErrorIs(err, ErrInvalidCredentials)
+}
+
+func (suite *testSuite) Test_RefreshRotationAndReuse(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+
+	newToken, newRefresh, err := suite.auth.RefreshToken(context.Background(), pair.AccessToken, pair.RefreshToken)
+	suite.Require().NoError(err)
+	suite.NotEmpty(newToken)
+	suite.NotEqual(pair.RefreshToken, newRefresh)
+
+	_, _, err = suite.auth.RefreshToken(context.Background(), "", pair.RefreshToken)
+	suite.ErrorIs(err, ErrRefreshReused)
+	_, _, err = suite.auth.RefreshToken(context.Background(), "", newRefresh)
+	suite.ErrorIs(err, ErrValidRefresh)
+}
+
+func (suite *testSuite) Test_RefreshWithExpiredAccess(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	suite.auth.tokenTTL = -time.Minute
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	_, err = suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.Require().ErrorIs(err, ErrValidAccess)
+
+	_, newRefresh, err := suite.auth.RefreshToken(context.Background(), pair.AccessToken, pair.RefreshToken)
+	suite.Require().NoError(err)
+
+	other, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "phone", "")
+	suite.Require().NoError(err)
+	_, _, err = suite.auth.RefreshToken(context.Background(), other.AccessToken, newRefresh)
+	suite.ErrorIs(err, ErrValidRefresh)
+}
+
+func (suite *testSuite) Test_ConcurrentRefreshOneWins(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+
+	const requests = 8
+	errs := make(chan error, requests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := suite.auth.RefreshToken(context.Background(), "", pair.RefreshToken)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		// loser which read the session before the winner saved it fails the generation check,
+		// one which read it after sees already rotated token
+		suite.True(errors.Is(err, ErrRefreshConflict) || errors.Is(err, ErrRefreshReused), err.Error())
+	}
+	suite.Equal(1, succeeded)
+}
+
+// blockingRepo waits for the request context instead of answering.
+type blockingRepo struct {
+	UserRepo
+}
+
+func (r blockingRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (suite *testSuite) Test_OperationTimeout(){
+	suite.auth.userRepo = blockingRepo{suite.auth.userRepo}
+	suite.auth.timeouts.Login = 10 * time.Millisecond
+	start := time.Now()
+	_, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.ErrorIs(err, ErrGetUserEmail)
+	suite.Less(time.Since(start), suite.auth.timeouts.Default)
+}
+
+func (suite *testSuite) Test_LockoutAfterFailedLogins(){
+	ctx := context.Background()
+	uuid, err := suite.auth.RegisterUser(ctx, "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	for i := 0; i < suite.auth.lockout.Threshold; i++ {
+		_, err = suite.auth.Login(ctx, "test@test.test", "wrong_password", "laptop", "")
+		suite.ErrorIs(err, ErrInvalidCredentials)
+	}
+	_, err = suite.auth.Login(ctx, "test@test.test", "wrong_password", "laptop", "")
+	suite.ErrorIs(err, ErrInvalidCredentials)
+	_, err = suite.auth.Login(ctx, "test@test.test", "test_password", "laptop", "")
+	suite.ErrorIs(err, ErrAccountLocked)
+
+	suite.Require().NoError(suite.auth.UnlockUser(ctx, uuid))
+	_, err = suite.auth.Login(ctx, "test@test.test", "test_password", "laptop", "")
+	suite.NoError(err)
+	suite.ErrorIs(suite.auth.UnlockUser(ctx, "missing"), storage.ErrUserNotFound)
+}
+
+func (suite *testSuite) Test_LockDuration(){
+	suite.Zero(lockDuration(time.Minute, time.Hour, -1))
+	suite.Equal(time.Minute, lockDuration(time.Minute, time.Hour, 0))
+	suite.Equal(4*time.Minute, lockDuration(time.Minute, time.Hour, 2))
+	suite.Equal(time.Hour, lockDuration(time.Minute, time.Hour, 100))
+}
+
+var (
+	// package tracer delegates only to the first global provider,
+	// so spans of all test runs are recorded by one provider
+	spans             = tracetest.NewSpanRecorder()
+	setTracerProvider sync.Once
+)
+
+// endedSpans returns ended spans of the trace.
+func endedSpans(traceId trace.TraceID) []sdktrace.ReadOnlySpan {
+	ended := []sdktrace.ReadOnlySpan{}
+	for _, span := range spans.Ended() {
+		if span.SpanContext().TraceID() == traceId {
+			ended = append(ended, span)
+		}
+	}
+	return ended
+}
+
+func (suite *testSuite) Test_SpansOfOperations(){
+	setTracerProvider.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	})
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	_, err := suite.auth.Login(ctx, "missing@test.test", "test_password", "laptop", "")
+	suite.ErrorIs(err, ErrInvalidCredentials)
+	parent.End()
+
+	ended := endedSpans(parent.SpanContext().TraceID())
+	suite.Require().Len(ended, 2)
+	suite.Equal("Auth.Login", ended[0].Name())
+	suite.Equal(parent.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	suite.Equal(codes.Error, ended[0].Status().Code)
+}
+
+func (suite *testSuite) Test_RevokeRefreshToken(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.auth.RevokeToken(context.Background(), pair.RefreshToken, models.TokenTypeRefresh))
+	_, _, err = suite.auth.RefreshToken(context.Background(), "", pair.RefreshToken)
+	suite.ErrorIs(err, ErrValidRefresh)
+	_, _, err = suite.auth.RefreshToken(context.Background(), pair.AccessToken, pair.RefreshToken)
+	suite.ErrorIs(err, ErrValidRefresh)
+	// revoking again or revoking unknown token is not an error
+	suite.NoError(suite.auth.RevokeToken(context.Background(), pair.RefreshToken, ""))
+	suite.NoError(suite.auth.RevokeToken(context.Background(), "unknown_token", ""))
+}
+
+func (suite *testSuite) Test_RevokeAccessToken(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	other, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "phone", "")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.auth.RevokeToken(context.Background(), pair.AccessToken, ""))
+	_, err = suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.ErrorIs(err, ErrValidAccess)
+	_, _, err = suite.auth.RefreshToken(context.Background(), "", pair.RefreshToken)
+	suite.ErrorIs(err, ErrValidRefresh)
+
+	_, _, err = suite.auth.RefreshToken(context.Background(), other.AccessToken, other.RefreshToken)
+	suite.NoError(err)
+}
+
+func (suite *testSuite) Test_LogoutAll(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	other, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "phone", "")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.auth.LogoutAll(context.Background(), pair.AccessToken))
+	for _, refresh := range []string{pair.RefreshToken, other.RefreshToken} {
+		_, _, err = suite.auth.RefreshToken(context.Background(), "", refresh)
+		suite.ErrorIs(err, ErrValidRefresh)
+	}
+	_, err = suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.ErrorIs(err, ErrValidAccess)
+	suite.ErrorIs(suite.auth.LogoutAll(context.Background(), pair.AccessToken), ErrValidAccess)
+	suite.ErrorIs(suite.auth.LogoutAll(context.Background(), "unknown_token"), ErrValidAccess)
+}
+
+func (suite *testSuite) Test_DeniedAccessToken(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	tokenClaims, err := suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.Require().NoError(err)
+	jti := tokenClaims["jti"].(string)
+
+	suite.Require().NoError(suite.auth.denylist.Deny(context.Background(), jti, time.Now().Add(time.Minute)))
+	_, err = suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.ErrorIs(err, ErrValidAccess)
+
+	// expired entry does not deny the token anymore
+	suite.Require().NoError(suite.auth.denylist.Deny(context.Background(), jti, time.Now().Add(-time.Second)))
+	_, err = suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.NoError(err)
+}
+
+func (suite *testSuite) Test_IntrospectToken(){
+	uuid, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+	tokenClaims, err := suite.auth.validateAccess(context.Background(), suite.auth.log, pair.AccessToken)
+	suite.Require().NoError(err)
+
+	res, err := suite.auth.IntrospectToken(context.Background(), pair.AccessToken, "")
+	suite.Require().NoError(err)
+	suite.Equal(&models.IntrospectionResponse{
+		Active: true,
+		Username: "test@test.test",
+		TokenType: models.TokenTypeAccess,
+		Exp: int64(tokenClaims["exp"].(float64)),
+		Iat: int64(tokenClaims["iat"].(float64)),
+		Sub: uuid,
+		Jti: tokenClaims["jti"].(string),
+	}, res)
+
+	res, err = suite.auth.IntrospectToken(context.Background(), pair.RefreshToken, models.TokenTypeRefresh)
+	suite.Require().NoError(err)
+	suite.True(res.Active)
+	suite.Equal(models.TokenTypeRefresh, res.TokenType)
+	suite.Equal(uuid, res.Sub)
+	suite.Empty(res.Username)
+	suite.Empty(res.Jti)
+
+	suite.Require().NoError(suite.auth.denylist.Deny(context.Background(), tokenClaims["jti"].(string), time.Now().Add(time.Minute)))
+	res, err = suite.auth.IntrospectToken(context.Background(), pair.AccessToken, models.TokenTypeAccess)
+	suite.Require().NoError(err)
+	suite.Equal(&models.IntrospectionResponse{Active: false}, res)
+}
+
+func (suite *testSuite) Test_IntrospectExpiredToken(){
+	_, err := suite.auth.RegisterUser(context.Background(), "test@test.test", "test_password")
+	suite.Require().NoError(err)
+	suite.auth.tokenTTL = -time.Minute
+	pair, err := suite.auth.Login(context.Background(), "test@test.test", "test_password", "laptop", "")
+	suite.Require().NoError(err)
+
+	res, err := suite.auth.IntrospectToken(context.Background(), pair.AccessToken, models.TokenTypeAccess)
+	suite.Require().NoError(err)
+	suite.Equal(&models.IntrospectionResponse{Active: false}, res)
+}
+
+func (suite *testSuite) Test_IntrospectMalformedToken(){
+	for _, token := range []string{"", "malformed", "a.b.c"} {
+		res, err := suite.auth.IntrospectToken(context.Background(), token, "")
+		suite.Require().NoError(err, token)
+		suite.Equal(&models.IntrospectionResponse{Active: false}, res, token)
+	}
+}
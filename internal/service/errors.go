@@ -6,8 +6,19 @@ var (
 	ErrCreateUUID = errors.New("error while creating uuid")
 	ErrSaveUser = errors.New("error while saving user")
 	ErrGetUserUUID = errors.New("cant get user by uuid")
+	ErrGetUserEmail = errors.New("cant get user by email")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPasswordPolicy = errors.New("password must be from 8 to 72 bytes long")
+	ErrGetSession = errors.New("cant get session")
 	ErrCreateJWT = errors.New("error while creating jwt")
 	ErrValidAccess = errors.New("access token doesnt valid")
 	ErrValidRefresh = errors.New("refresh token doesnt valid")
+	ErrRefreshReused = errors.New("refresh token was already used")
+	ErrRefreshConflict = errors.New("refresh token was rotated by concurrent request")
 	ErrCreateRefresh = errors.New("error while creating refresh token")
-)
\ No newline at end of file
+	ErrRevokeSession = errors.New("error while revoking session")
+	ErrRevokeAccess = errors.New("error while revoking access token")
+	ErrCheckDenylist = errors.New("error while checking token denylist")
+	ErrAccountLocked = errors.New("account is temporarily locked")
+	ErrUnlockUser = errors.New("error while unlocking user")
+)
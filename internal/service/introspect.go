@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
+)
+
+// IntrospectToken returns state of the token as described in RFC 7662.
+// Invalid, expired or revoked tokens are reported as inactive,
+// only storage failures are returned as error.
+func (a *Auth) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (res *models.IntrospectionResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.IntrospectToken")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "introspect_token"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Introspect)
+	defer cancel()
+	introspectors := []func(context.Context, *slog.Logger, string) (*models.IntrospectionResponse, error){a.introspectAccess, a.introspectRefresh}
+	if tokenTypeHint == models.TokenTypeRefresh {
+		introspectors[0], introspectors[1] = introspectors[1], introspectors[0]
+	}
+	for _, introspect := range introspectors {
+		res, err := introspect(ctx, log, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed introspect token: %w", err)
+		}
+		if res.Active {
+			return res, nil
+		}
+	}
+	return &models.IntrospectionResponse{Active: false}, nil
+}
+
+func (a *Auth) introspectAccess(ctx context.Context, log *slog.Logger, accessToken string) (*models.IntrospectionResponse, error) {
+	tokenClaims, err := a.validateAccess(ctx, log, accessToken)
+	if err != nil {
+		if errors.Is(err, ErrValidAccess) {
+			return &models.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+	res := &models.IntrospectionResponse{
+		Active:    true,
+		TokenType: models.TokenTypeAccess,
+	}
+	res.Sub, _ = tokenClaims["uuid"].(string)
+	res.Username, _ = tokenClaims["email"].(string)
+	res.Jti, _ = tokenClaims["jti"].(string)
+	if exp, ok := tokenClaims["exp"].(float64); ok {
+		res.Exp = int64(exp)
+	}
+	if iat, ok := tokenClaims["iat"].(float64); ok {
+		res.Iat = int64(iat)
+	}
+	if sessionId, ok := tokenClaims["sid"].(string); ok {
+		session, err := a.userRepo.GetSession(ctx, sessionId)
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				return &models.IntrospectionResponse{Active: false}, nil
+			}
+			log.Warn(ErrGetSession.Error(), slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%w: %w", ErrGetSession, err)
+		}
+		if session.RevokedAt != 0 {
+			return &models.IntrospectionResponse{Active: false}, nil
+		}
+	}
+	return res, nil
+}
+
+func (a *Auth) introspectRefresh(ctx context.Context, log *slog.Logger, refreshToken string) (*models.IntrospectionResponse, error) {
+	session, current, err := a.findRefreshSession(ctx, log, refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrValidRefresh) {
+			return &models.IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+	if !current || session.RevokedAt != 0 || time.Now().Unix() > session.ExpiresAt {
+		return &models.IntrospectionResponse{Active: false}, nil
+	}
+	return &models.IntrospectionResponse{
+		Active:    true,
+		TokenType: models.TokenTypeRefresh,
+		Sub:       session.UUID,
+		Exp:       session.ExpiresAt,
+		Iat:       session.LastUsedAt,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
+)
+
+// checkLock returns ErrAccountLocked while the user is locked.
+func (a *Auth) checkLock(log *slog.Logger, uuid string, lockedUntil int64, now time.Time) error {
+	if !a.lockout.Enabled || lockedUntil <= now.Unix() {
+		return nil
+	}
+	log.Info("account is locked", slog.String("uuid", uuid), slog.Time("locked_until", time.Unix(lockedUntil, 0)))
+	return ErrAccountLocked
+}
+
+// recordFailure counts failed attempt of the user and locks it when there are too many of them.
+// Storage failures are only logged, so they do not replace the error returned to the client.
+func (a *Auth) recordFailure(ctx context.Context, log *slog.Logger, uuid string) {
+	if !a.lockout.Enabled {
+		return
+	}
+	now := time.Now()
+	notBefore := int64(math.MinInt64)
+	if a.lockout.Window > 0 {
+		notBefore = now.Add(-a.lockout.Window).Unix()
+	}
+	attempts, err := a.userRepo.RecordFailedAttempt(ctx, uuid, now.Unix(), notBefore)
+	if err != nil {
+		log.Error("failed to record failed attempt", slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return
+	}
+	duration := lockDuration(a.lockout.BaseDuration, a.lockout.MaxDuration, attempts-a.lockout.Threshold)
+	if duration == 0 {
+		return
+	}
+	if err = a.userRepo.LockUser(ctx, uuid, now.Add(duration).Unix()); err != nil {
+		log.Error("failed to lock account", slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return
+	}
+	log.Warn("account locked",
+		slog.String("event", "account_lockout"),
+		slog.String("uuid", uuid),
+		slog.Int("failed_attempts", attempts),
+		slog.Duration("duration", duration),
+	)
+}
+
+// lockDuration doubles base for every attempt over the threshold, over is
+// zero for the attempt reaching it. Negative over means no lock.
+func lockDuration(base, maxDuration time.Duration, over int) time.Duration {
+	if over < 0 || base <= 0 {
+		return 0
+	}
+	duration := base
+	for i := 0; i < over && (maxDuration <= 0 || duration < maxDuration); i++ {
+		duration *= 2
+	}
+	if maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+// UnlockUser removes the lock and forgets failed attempts of the user.
+func (a *Auth) UnlockUser(ctx context.Context, uuid string) (err error) {
+	ctx, span := tracer.Start(ctx, "Auth.UnlockUser")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "unlock_user"))
+	ctx, cancel := a.withTimeout(ctx, 0)
+	defer cancel()
+	err = a.userRepo.ResetFailedAttempts(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("failed unlock user", slog.String("uuid", uuid), slog.String("error", err.Error()))
+			return fmt.Errorf("failed unlock user: %w", storage.ErrUserNotFound)
+		}
+		log.Warn(ErrUnlockUser.Error(), slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return fmt.Errorf("failed unlock user: %w: %w", ErrUnlockUser, err)
+	}
+	log.Info("user unlocked", slog.String("uuid", uuid))
+	return nil
+}
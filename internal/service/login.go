@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordLength = 72
+)
+
+// Login checks email and password and starts a new session of the user.
+func (a *Auth) Login(ctx context.Context, email, password, device, nonce string) (pair *models.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "Auth.Login")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "login"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Login)
+	defer cancel()
+	user, err := a.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			a.verifyHash(log, password, a.dummyHash)
+			log.Info("failed login", slog.String("error", storage.ErrUserNotFound.Error()))
+			return nil, fmt.Errorf("failed login: %w", ErrInvalidCredentials)
+		}
+		log.Warn(ErrGetUserEmail.Error(), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed login: %w: %w", ErrGetUserEmail, err)
+	}
+	if user.PasswordHash == "" {
+		a.verifyHash(log, password, a.dummyHash)
+		log.Info("failed login: user has no password", slog.String("uuid", user.UUID))
+		return nil, fmt.Errorf("failed login: %w", ErrInvalidCredentials)
+	}
+	if !a.verifyHash(log, password, user.PasswordHash) {
+		log.Info("failed login: wrong password", slog.String("uuid", user.UUID))
+		a.recordFailure(ctx, log, user.UUID)
+		return nil, fmt.Errorf("failed login: %w", ErrInvalidCredentials)
+	}
+	// lock is reported only after the password is checked, otherwise
+	// the lock response would tell that the email is registered
+	if err = a.checkLock(log, user.UUID, user.LockedUntil, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed login: %w", err)
+	}
+	if user.FailedAttempts > 0 {
+		if err = a.userRepo.ResetFailedAttempts(ctx, user.UUID); err != nil {
+			log.Error("failed to reset failed attempts", slog.String("uuid", user.UUID), slog.String("error", err.Error()))
+		}
+	}
+	if a.hasher.NeedsRehash(user.PasswordHash) {
+		a.rehashPassword(ctx, log, user.UUID, password)
+	}
+	pair, err = a.issueTokenPair(ctx, log, user, device, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed login: %w", err)
+	}
+	return pair, nil
+}
+
+func checkPasswordPolicy(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrPasswordPolicy
+	}
+	return nil
+}
+
+// rehashPassword updates password hash made with outdated algorithm or parameters.
+// Failure is not critical, so it is only logged.
+func (a *Auth) rehashPassword(ctx context.Context, log *slog.Logger, uuid, password string) {
+	passwordHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to rehash password", slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return
+	}
+	err = a.userRepo.UpdatePasswordHash(ctx, uuid, passwordHash)
+	if err != nil {
+		log.Error("failed to save rehashed password", slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return
+	}
+	log.Info("password rehashed", slog.String("uuid", uuid))
+}
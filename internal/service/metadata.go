@@ -0,0 +1,23 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+)
+
+// Metadata returns metadata of issued tokens and endpoints working with them.
+func (a *Auth) Metadata() models.Metadata {
+	issuer := strings.TrimSuffix(a.oidc.Issuer, "/")
+	return models.Metadata{
+		Issuer:                           a.oidc.Issuer,
+		JwksURI:                          issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:               issuer + "/api/revoke",
+		RevocationEndpointAuthMethods:    []string{"client_secret_basic"},
+		IntrospectionEndpoint:            issuer + "/api/introspect",
+		IntrospectionEndpointAuthMethods: []string{"client_secret_basic"},
+		SubjectTypesSupported:            []string{"public"},
+		IdTokenSigningAlgValuesSupported: []string{a.jwtManager.Algorithm()},
+		ClaimsSupported:                  []string{"iss", "aud", "sub", "iat", "exp", "nonce", "email"},
+	}
+}
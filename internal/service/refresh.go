@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+)
+
+// Refresh token given to the client is "<selector>:<verifier>" encoded with base64.
+// Selector locates the session by index, verifier is compared with its
+// keyed digest in constant time, so neither access token nor slow hashing is needed.
+
+// usedRefreshLimit is how many rotated refresh tokens are kept per family for reuse detection.
+const usedRefreshLimit = 16
+
+func encodeRefresh(selector, verifier string) string {
+	return base64.StdEncoding.EncodeToString([]byte(selector + ":" + verifier))
+}
+
+func decodeRefresh(encoded string) (selector, verifier string, err error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", ErrValidRefresh
+	}
+	selector, verifier, ok := strings.Cut(string(raw), ":")
+	if !ok || selector == "" || verifier == "" {
+		return "", "", ErrValidRefresh
+	}
+	return selector, verifier, nil
+}
+
+// newRefresh creates refresh token for the client and parts of it which are stored.
+func (a *Auth) newRefresh() (refresh, selector, digest string, err error) {
+	selector, err = a.jwtManager.CreateRefresh()
+	if err != nil {
+		return "", "", "", err
+	}
+	verifier, err := a.jwtManager.CreateRefresh()
+	if err != nil {
+		return "", "", "", err
+	}
+	return encodeRefresh(selector, verifier), selector, a.digester.Digest(verifier), nil
+}
+
+func rotateRefresh(session *models.Session, selector, digest string, now time.Time, refreshTTL time.Duration) {
+	session.UsedRefreshes = append(session.UsedRefreshes, models.UsedRefresh{
+		Selector: session.RefreshSelector,
+		Digest:   session.RefreshDigest,
+	})
+	if len(session.UsedRefreshes) > usedRefreshLimit {
+		session.UsedRefreshes = session.UsedRefreshes[len(session.UsedRefreshes)-usedRefreshLimit:]
+	}
+	session.RefreshSelector = selector
+	session.RefreshDigest = digest
+	session.Generation++
+	session.LastUsedAt = now.Unix()
+	session.ExpiresAt = now.Add(refreshTTL).Unix()
+}
+
+// findRefreshSession returns the session the refresh token was issued for.
+// When the selector is found but the verifier does not match, the session is returned with ErrValidRefresh.
+// current reports whether the token is the latest one in the family
+// or was already rotated.
+func (a *Auth) findRefreshSession(ctx context.Context, log *slog.Logger, refreshToken string) (session *models.Session, current bool, err error) {
+	selector, verifier, err := decodeRefresh(refreshToken)
+	if err != nil {
+		return nil, false, ErrValidRefresh
+	}
+	session, err = a.userRepo.GetSessionBySelector(ctx, selector)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, false, ErrValidRefresh
+		}
+		log.Warn(ErrGetSession.Error(), slog.String("error", err.Error()))
+		return nil, false, fmt.Errorf("%w: %w", ErrGetSession, err)
+	}
+	digest, current := session.RefreshDigest, session.RefreshSelector == selector
+	if !current {
+		digest = ""
+		for _, used := range session.UsedRefreshes {
+			if used.Selector == selector {
+				digest = used.Digest
+			}
+		}
+	}
+	// the session is returned with the error, so the failure can be counted for its user
+	if digest == "" || !a.digester.Verify(verifier, digest) {
+		return session, false, ErrValidRefresh
+	}
+	return session, current, nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/logger"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
+)
+
+// RevokeToken invalidates the session the token belongs to.
+// Revoked access token is also put into denylist until it expires.
+// As described in RFC 7009 invalid or unknown tokens are not an error,
+// so only storage failures are returned.
+func (a *Auth) RevokeToken(ctx context.Context, token, tokenTypeHint string) (err error) {
+	ctx, span := tracer.Start(ctx, "Auth.RevokeToken")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "revoke_token"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Revoke)
+	defer cancel()
+	revokers := []func(context.Context, *slog.Logger, string) (bool, error){a.revokeRefresh, a.revokeAccess}
+	if tokenTypeHint == models.TokenTypeAccess {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+	for _, revoke := range revokers {
+		revoked, err := revoke(ctx, log, token)
+		if err != nil {
+			return fmt.Errorf("failed revoke token: %w", err)
+		}
+		if revoked {
+			return nil
+		}
+	}
+	log.Info("token for revocation is not valid")
+	return nil
+}
+
+// LogoutAll revokes every session of the access token owner.
+func (a *Auth) LogoutAll(ctx context.Context, accessToken string) (err error) {
+	ctx, span := tracer.Start(ctx, "Auth.LogoutAll")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx, a.log).With(slog.String("auth.method", "logout_all"))
+	ctx, cancel := a.withTimeout(ctx, a.timeouts.Revoke)
+	defer cancel()
+	tokenClaims, err := a.validateAccess(ctx, log, accessToken)
+	if err != nil {
+		return fmt.Errorf("failed logout: %w", err)
+	}
+	uuid, ok := tokenClaims["uuid"].(string)
+	if !ok {
+		log.Info("cant get uuid from token claims")
+		return fmt.Errorf("failed logout: %w", ErrValidAccess)
+	}
+	err = a.userRepo.RevokeUserSessions(ctx, uuid)
+	if err != nil {
+		log.Error("failed to revoke user sessions", slog.String("uuid", uuid), slog.String("error", err.Error()))
+		return fmt.Errorf("failed logout: %w: %w", ErrRevokeSession, err)
+	}
+	if err = a.denyAccess(ctx, log, tokenClaims); err != nil {
+		return fmt.Errorf("failed logout: %w", err)
+	}
+	log.Info("all user sessions revoked", slog.String("uuid", uuid))
+	return nil
+}
+
+func (a *Auth) revokeRefresh(ctx context.Context, log *slog.Logger, refreshToken string) (revoked bool, err error) {
+	session, _, err := a.findRefreshSession(ctx, log, refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrValidRefresh) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, a.revokeSession(ctx, log, session.Id)
+}
+
+func (a *Auth) revokeAccess(ctx context.Context, log *slog.Logger, accessToken string) (revoked bool, err error) {
+	tokenClaims, err := a.jwtManager.ParseTokenClaims(accessToken)
+	if err != nil {
+		return false, nil
+	}
+	if err = a.denyAccess(ctx, log, tokenClaims); err != nil {
+		return false, err
+	}
+	sessionId, ok := tokenClaims["sid"].(string)
+	if !ok {
+		return true, nil
+	}
+	return true, a.revokeSession(ctx, log, sessionId)
+}
+
+func (a *Auth) revokeSession(ctx context.Context, log *slog.Logger, sessionId string) error {
+	err := a.userRepo.RevokeSession(ctx, sessionId)
+	if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+		log.Error("failed to revoke session", slog.String("session_id", sessionId), slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %w", ErrRevokeSession, err)
+	}
+	log.Info("session revoked", slog.String("session_id", sessionId))
+	return nil
+}
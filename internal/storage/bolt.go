@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	usersBucket        = []byte("users")
+	userEmailsBucket   = []byte("user_emails")
+	sessionsBucket     = []byte("sessions")
+	userSessionsBucket = []byte("user_sessions")
+	selectorsBucket    = []byte("refresh_selectors")
+	denylistBucket     = []byte("denylist")
+)
+
+type boltProvider struct {
+	cfg config.BoltConfig
+	db  *bolt.DB
+}
+
+// NewBoltProvider opens embedded database file, creating it if needed.
+// The file is locked, so it can be used only by one process at once, Close releases it.
+// Expired sessions and denylist entries are removed every cfg.CleanupInterval until ctx is done.
+func NewBoltProvider(ctx context.Context, cfg config.BoltConfig) (*boltProvider, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{
+		Timeout:        cfg.OpenTimeout,
+		NoSync:         cfg.NoSync,
+		NoFreelistSync: cfg.NoFreelistSync,
+		FreelistType:   bolt.FreelistMapType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{usersBucket, userEmailsBucket, sessionsBucket, userSessionsBucket, selectorsBucket, denylistBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return normalizeBoltEmails(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	b := &boltProvider{
+		cfg: cfg,
+		db:  db,
+	}
+	if cfg.CleanupInterval > 0 {
+		go b.cleanup(ctx, cfg.CleanupInterval)
+	}
+	return b, nil
+}
+
+func (b *boltProvider) SaveUser(ctx context.Context, user *models.User) (err error) {
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		users, emails := tx.Bucket(usersBucket), tx.Bucket(userEmailsBucket)
+		if users.Get([]byte(user.UUID)) != nil || emails.Get([]byte(user.Email)) != nil {
+			return ErrUserExist
+		}
+		if err := users.Put([]byte(user.UUID), data); err != nil {
+			return err
+		}
+		return emails.Put([]byte(user.Email), []byte(user.UUID))
+	})
+}
+
+func (b *boltProvider) GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		user, err = getBoltUser(tx, uuid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (b *boltProvider) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		uuid := tx.Bucket(userEmailsBucket).Get([]byte(email))
+		if uuid == nil {
+			return ErrUserNotFound
+		}
+		user, err = getBoltUser(tx, string(uuid))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func getBoltUser(tx *bolt.Tx, uuid string) (user *models.User, err error) {
+	data := tx.Bucket(usersBucket).Get([]byte(uuid))
+	if data == nil {
+		return nil, ErrUserNotFound
+	}
+	user = &models.User{}
+	if err = bson.Unmarshal(data, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// normalizeBoltEmails rewrites stored emails to the normalized form used by lookups.
+// It runs on every open and changes nothing once emails are normalized.
+func normalizeBoltEmails(tx *bolt.Tx) error {
+	emails := make(map[string]string)
+	err := tx.Bucket(userEmailsBucket).ForEach(func(email, uuid []byte) error {
+		emails[string(uuid)] = string(email)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	changed, err := normalizeEmails(emails)
+	if err != nil {
+		return err
+	}
+	// old keys are removed first, so the new one can not be overwritten by them
+	for uuid := range changed {
+		if err = tx.Bucket(userEmailsBucket).Delete([]byte(emails[uuid])); err != nil {
+			return err
+		}
+	}
+	for uuid, email := range changed {
+		user, err := getBoltUser(tx, uuid)
+		if err != nil {
+			return err
+		}
+		user.Email = email
+		data, err := bson.Marshal(user)
+		if err != nil {
+			return err
+		}
+		if err = tx.Bucket(usersBucket).Put([]byte(uuid), data); err != nil {
+			return err
+		}
+		if err = tx.Bucket(userEmailsBucket).Put([]byte(email), []byte(uuid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltProvider) UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error) {
+	return b.updateUser(uuid, func(user *models.User) {
+		user.PasswordHash = passwordHash
+	})
+}
+
+func (b *boltProvider) RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error) {
+	err = b.updateUser(uuid, func(user *models.User) {
+		if user.LastFailedAt < notBefore {
+			user.FailedAttempts = 0
+		}
+		user.FailedAttempts++
+		user.LastFailedAt = now
+		attempts = user.FailedAttempts
+	})
+	return
+}
+
+func (b *boltProvider) LockUser(ctx context.Context, uuid string, until int64) (err error) {
+	return b.updateUser(uuid, func(user *models.User) {
+		user.LockedUntil = max(user.LockedUntil, until)
+	})
+}
+
+func (b *boltProvider) ResetFailedAttempts(ctx context.Context, uuid string) (err error) {
+	return b.updateUser(uuid, func(user *models.User) {
+		user.FailedAttempts, user.LastFailedAt, user.LockedUntil = 0, 0, 0
+	})
+}
+
+// updateUser changes the user within single transaction.
+func (b *boltProvider) updateUser(uuid string, update func(user *models.User)) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		user, err := getBoltUser(tx, uuid)
+		if err != nil {
+			return err
+		}
+		update(user)
+		data, err := bson.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUpdate, err)
+		}
+		return tx.Bucket(usersBucket).Put([]byte(uuid), data)
+	})
+}
+
+func (b *boltProvider) SaveSession(ctx context.Context, session *models.Session) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(sessionsBucket).Get([]byte(session.Id)) != nil {
+			return ErrSessionExist
+		}
+		if err := tx.Bucket(userSessionsBucket).Put(userSessionKey(session.UUID, session.Id), nil); err != nil {
+			return err
+		}
+		return putBoltSession(tx, session)
+	})
+}
+
+func (b *boltProvider) GetSession(ctx context.Context, sessionId string) (session *models.Session, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		session, err = getBoltSession(tx, sessionId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionBySelector uses the selectors bucket, which indexes current and rotated selectors.
+func (b *boltProvider) GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		sessionId := tx.Bucket(selectorsBucket).Get([]byte(selector))
+		if sessionId == nil {
+			return ErrSessionNotFound
+		}
+		session, err = getBoltSession(tx, string(sessionId))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// UpdateSession checks the generation and reindexes selectors in one write transaction.
+func (b *boltProvider) UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getBoltSession(tx, session.Id)
+		if err != nil {
+			return err
+		}
+		if stored.Generation != expectedGeneration || stored.RevokedAt != 0 {
+			return ErrSessionConflict
+		}
+		selectors := tx.Bucket(selectorsBucket)
+		if err = selectors.Delete([]byte(stored.RefreshSelector)); err != nil {
+			return fmt.Errorf("%w: %w", ErrUpdate, err)
+		}
+		for _, used := range stored.UsedRefreshes {
+			if err = selectors.Delete([]byte(used.Selector)); err != nil {
+				return fmt.Errorf("%w: %w", ErrUpdate, err)
+			}
+		}
+		if err = putBoltSession(tx, session); err != nil {
+			return fmt.Errorf("%w: %w", ErrUpdate, err)
+		}
+		return nil
+	})
+}
+
+func (b *boltProvider) RevokeSession(ctx context.Context, sessionId string) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		session, err := getBoltSession(tx, sessionId)
+		if err != nil {
+			return err
+		}
+		session.RevokedAt = time.Now().Unix()
+		return putBoltSession(tx, session)
+	})
+}
+
+func (b *boltProvider) RevokeUserSessions(ctx context.Context, uuid string) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now().Unix()
+		prefix := userSessionKey(uuid, "")
+		cursor := tx.Bucket(userSessionsBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			session, err := getBoltSession(tx, string(key[len(prefix):]))
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrUpdate, err)
+			}
+			if session.RevokedAt != 0 {
+				continue
+			}
+			session.RevokedAt = now
+			if err = putBoltSession(tx, session); err != nil {
+				return fmt.Errorf("%w: %w", ErrUpdate, err)
+			}
+		}
+		return nil
+	})
+}
+
+func getBoltSession(tx *bolt.Tx, sessionId string) (session *models.Session, err error) {
+	data := tx.Bucket(sessionsBucket).Get([]byte(sessionId))
+	if data == nil {
+		return nil, ErrSessionNotFound
+	}
+	session = &models.Session{}
+	if err = bson.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// putBoltSession stores the session and indexes its selectors.
+func putBoltSession(tx *bolt.Tx, session *models.Session) (err error) {
+	if session.UsedRefreshes == nil {
+		session.UsedRefreshes = []models.UsedRefresh{}
+	}
+	data, err := bson.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err = tx.Bucket(sessionsBucket).Put([]byte(session.Id), data); err != nil {
+		return err
+	}
+	selectors := tx.Bucket(selectorsBucket)
+	if err = selectors.Put([]byte(session.RefreshSelector), []byte(session.Id)); err != nil {
+		return err
+	}
+	for _, used := range session.UsedRefreshes {
+		if err = selectors.Put([]byte(used.Selector), []byte(session.Id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userSessionKey is "<uuid>/<session id>", so sessions of the user are found by prefix.
+func userSessionKey(uuid, sessionId string) []byte {
+	return []byte(uuid + "/" + sessionId)
+}
+
+func (b *boltProvider) Deny(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(expiresAt.UnixNano()))
+		return tx.Bucket(denylistBucket).Put([]byte(jti), value)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return
+}
+
+// IsDenied also checks expiration time by itself, because
+// expired entries are removed only once per cleanup interval.
+func (b *boltProvider) IsDenied(ctx context.Context, jti string) (denied bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(denylistBucket).Get([]byte(jti))
+		denied = value != nil && time.Now().UnixNano() < int64(binary.BigEndian.Uint64(value))
+		return nil
+	})
+	return
+}
+
+// Backup writes consistent copy of the database file to w
+// without blocking writers, so it can be done while serving requests.
+func (b *boltProvider) Backup(ctx context.Context, w io.Writer) (n int64, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return
+}
+
+func (b *boltProvider) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// failed cleanup is retried on the next tick
+			b.removeExpired(now)
+		}
+	}
+}
+
+// removeExpired removes expired denylist entries and sessions together with their indexes.
+func (b *boltProvider) removeExpired(now time.Time) (err error) {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		denylist := tx.Bucket(denylistBucket)
+		// deleting while iterating with cursor skips keys, so they are collected first
+		expired := [][]byte{}
+		denylist.ForEach(func(key, value []byte) error {
+			if now.UnixNano() >= int64(binary.BigEndian.Uint64(value)) {
+				expired = append(expired, append([]byte{}, key...))
+			}
+			return nil
+		})
+		for _, key := range expired {
+			if err := denylist.Delete(key); err != nil {
+				return err
+			}
+		}
+		sessions := []*models.Session{}
+		err := tx.Bucket(sessionsBucket).ForEach(func(key, value []byte) error {
+			session := &models.Session{}
+			if err := bson.Unmarshal(value, session); err != nil {
+				return err
+			}
+			if session.ExpiresAt <= now.Unix() {
+				sessions = append(sessions, session)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			if err = deleteBoltSession(tx, session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteBoltSession removes the session and its entries in the indexes.
+func deleteBoltSession(tx *bolt.Tx, session *models.Session) (err error) {
+	selectors := tx.Bucket(selectorsBucket)
+	if err = selectors.Delete([]byte(session.RefreshSelector)); err != nil {
+		return err
+	}
+	for _, used := range session.UsedRefreshes {
+		if err = selectors.Delete([]byte(used.Selector)); err != nil {
+			return err
+		}
+	}
+	if err = tx.Bucket(userSessionsBucket).Delete(userSessionKey(session.UUID, session.Id)); err != nil {
+		return err
+	}
+	return tx.Bucket(sessionsBucket).Delete([]byte(session.Id))
+}
+
+// Close closes the database and releases the file lock.
+// It waits for open transactions, so it is called after the server stopped serving requests.
+func (b *boltProvider) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltTestSuite struct {
+	suite.Suite
+	ctx      context.Context
+	cancel   context.CancelFunc
+	path     string
+	provider *boltProvider
+}
+
+func TestBoltSuiteRun(t *testing.T) {
+	suite.Run(t, new(boltTestSuite))
+}
+
+func (suite *boltTestSuite) SetupTest() {
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.path = filepath.Join(suite.T().TempDir(), "auth.db")
+	provider, err := NewBoltProvider(suite.ctx, config.BoltConfig{
+		Path: suite.path,
+		OpenTimeout: time.Second,
+	})
+	suite.Require().NoError(err)
+	suite.provider = provider
+}
+
+func (suite *boltTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.Require().NoError(suite.provider.Close())
+}
+
+func (suite *boltTestSuite) Test_UserSemantics(){
+	user := &models.User{Email: "test@test.test", UUID: uuid.NewString(), PasswordHash: "hash"}
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, user))
+	suite.ErrorIs(suite.provider.SaveUser(suite.ctx, &models.User{Email: user.Email, UUID: uuid.NewString()}), ErrUserExist)
+
+	found, err := suite.provider.GetUserByEmail(suite.ctx, user.Email)
+	suite.Require().NoError(err)
+	suite.Equal(user.UUID, found.UUID)
+	suite.Equal("hash", found.PasswordHash)
+
+	suite.Require().NoError(suite.provider.UpdatePasswordHash(suite.ctx, user.UUID, "new_hash"))
+	found, err = suite.provider.GetUserByUUID(suite.ctx, user.UUID)
+	suite.Require().NoError(err)
+	suite.Equal("new_hash", found.PasswordHash)
+
+	_, err = suite.provider.GetUserByUUID(suite.ctx, uuid.NewString())
+	suite.ErrorIs(err, ErrUserNotFound)
+}
+
+func (suite *boltTestSuite) Test_SessionSelectorIndex(){
+	session := &models.Session{Id: uuid.NewString(), UUID: uuid.NewString(), RefreshSelector: "first", RefreshDigest: "digest"}
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, session))
+	suite.ErrorIs(suite.provider.SaveSession(suite.ctx, session), ErrSessionExist)
+
+	session.UsedRefreshes = append(session.UsedRefreshes, models.UsedRefresh{Selector: "first", Digest: "digest"})
+	session.RefreshSelector = "second"
+	suite.Require().NoError(suite.provider.UpdateSession(suite.ctx, session, 0))
+	for _, selector := range []string{"first", "second"} {
+		found, err := suite.provider.GetSessionBySelector(suite.ctx, selector)
+		suite.Require().NoError(err, selector)
+		suite.Equal(session.Id, found.Id)
+		suite.Len(found.UsedRefreshes, 1)
+	}
+
+	suite.Require().NoError(suite.provider.RevokeUserSessions(suite.ctx, session.UUID))
+	found, err := suite.provider.GetSession(suite.ctx, session.Id)
+	suite.Require().NoError(err)
+	suite.NotZero(found.RevokedAt)
+	suite.ErrorIs(suite.provider.UpdateSession(suite.ctx, &models.Session{Id: uuid.NewString()}, 0), ErrSessionNotFound)
+}
+
+func (suite *boltTestSuite) Test_NormalizeStoredEmails(){
+	user := &models.User{Email: "Test@Test.Test", UUID: uuid.NewString()}
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, user))
+	suite.Require().NoError(suite.provider.db.Update(normalizeBoltEmails))
+
+	found, err := suite.provider.GetUserByEmail(suite.ctx, "test@test.test")
+	suite.Require().NoError(err)
+	suite.Equal(user.UUID, found.UUID)
+	suite.Equal("test@test.test", found.Email)
+	_, err = suite.provider.GetUserByEmail(suite.ctx, user.Email)
+	suite.ErrorIs(err, ErrUserNotFound)
+
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, &models.User{Email: "TEST@test.test", UUID: uuid.NewString()}))
+	suite.ErrorIs(suite.provider.db.Update(normalizeBoltEmails), ErrEmailCollision)
+}
+
+func (suite *boltTestSuite) Test_Denylist(){
+	suite.Require().NoError(suite.provider.Deny(suite.ctx, "active", time.Now().Add(time.Minute)))
+	suite.Require().NoError(suite.provider.Deny(suite.ctx, "expired", time.Now().Add(-time.Minute)))
+	denied, err := suite.provider.IsDenied(suite.ctx, "active")
+	suite.Require().NoError(err)
+	suite.True(denied)
+	denied, err = suite.provider.IsDenied(suite.ctx, "expired")
+	suite.Require().NoError(err)
+	suite.False(denied)
+}
+
+func (suite *boltTestSuite) Test_RemoveExpiredSessions(){
+	now := time.Now()
+	expired := &models.Session{
+		Id: uuid.NewString(),
+		UUID: uuid.NewString(),
+		RefreshSelector: "expired",
+		UsedRefreshes: []models.UsedRefresh{{Selector: "expired_used"}},
+		ExpiresAt: now.Add(-time.Second).Unix(),
+	}
+	active := &models.Session{Id: uuid.NewString(), UUID: expired.UUID, RefreshSelector: "active", ExpiresAt: now.Add(time.Hour).Unix()}
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, expired))
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, active))
+
+	suite.Require().NoError(suite.provider.removeExpired(now))
+	_, err := suite.provider.GetSession(suite.ctx, expired.Id)
+	suite.ErrorIs(err, ErrSessionNotFound)
+	_, err = suite.provider.GetSessionBySelector(suite.ctx, "expired_used")
+	suite.ErrorIs(err, ErrSessionNotFound)
+	_, err = suite.provider.GetSessionBySelector(suite.ctx, "active")
+	suite.NoError(err)
+	suite.Require().NoError(suite.provider.db.View(func(tx *bolt.Tx) error {
+		suite.Equal(1, tx.Bucket(selectorsBucket).Stats().KeyN)
+		suite.Equal(1, tx.Bucket(userSessionsBucket).Stats().KeyN)
+		return nil
+	}))
+}
+
+func (suite *boltTestSuite) Test_Backup(){
+	user := &models.User{Email: "test@test.test", UUID: uuid.NewString()}
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, user))
+	buffer := &bytes.Buffer{}
+	n, err := suite.provider.Backup(suite.ctx, buffer)
+	suite.Require().NoError(err)
+	suite.Equal(int64(buffer.Len()), n)
+
+	backupPath := filepath.Join(suite.T().TempDir(), "backup.db")
+	suite.Require().NoError(os.WriteFile(backupPath, buffer.Bytes(), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restored, err := NewBoltProvider(ctx, config.BoltConfig{Path: backupPath, OpenTimeout: time.Second})
+	suite.Require().NoError(err)
+	defer restored.Close()
+	found, err := restored.GetUserByEmail(ctx, user.Email)
+	suite.Require().NoError(err)
+	suite.Equal(user.UUID, found.UUID)
+}
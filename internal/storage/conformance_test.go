@@ -0,0 +1,78 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/EwvwGeN/medods_assignment/internal/storage/storagetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Repo {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return struct {
+			service.UserRepo
+			service.TokenDenylist
+		}{storage.NewMemoryProvider(ctx, time.Minute), storage.NewMemoryDenylist(ctx, time.Minute)}
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Repo {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		provider, err := storage.NewBoltProvider(ctx, config.BoltConfig{
+			Path: filepath.Join(t.TempDir(), "auth.db"),
+			OpenTimeout: time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return provider
+	})
+}
+
+// Backends needing a running database are tested only when
+// STORAGE_TEST_CONFIG points to the config with their connection settings.
+func loadTestConfig(t *testing.T) *config.Config {
+	path := os.Getenv("STORAGE_TEST_CONFIG")
+	if path == "" {
+		t.Skip("STORAGE_TEST_CONFIG is not set")
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestMongoConformance(t *testing.T) {
+	cfg := loadTestConfig(t)
+	provider, err := storage.NewMongoProvider(context.Background(), cfg.MongoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storagetest.Run(t, func(t *testing.T) storagetest.Repo {
+		return provider
+	})
+}
+
+func TestPostgresConformance(t *testing.T) {
+	cfg := loadTestConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider, err := storage.NewPostgresProvider(ctx, cfg.PostgresConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storagetest.Run(t, func(t *testing.T) storagetest.Repo {
+		return provider
+	})
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/EwvwGeN/medods_assignment/internal/validator"
+)
+
+// normalizeEmails returns emails which change after normalization keyed by user uuid.
+// Users were registered before requests were validated, so stored emails may differ
+// in case or domain encoding from the normalized ones used for lookups.
+// Addresses which can not be normalized are left as is: validation rejects them,
+// so such users can not log in until the address is fixed by hand.
+func normalizeEmails(emails map[string]string) (changed map[string]string, err error) {
+	changed = make(map[string]string)
+	owners := make(map[string][]string, len(emails))
+	for uuid, email := range emails {
+		normalized, err := validator.NormalizeEmail(email)
+		if err != nil {
+			normalized = email
+		}
+		if normalized != email {
+			changed[uuid] = normalized
+		}
+		owners[normalized] = append(owners[normalized], email)
+	}
+	collisions := []string{}
+	for normalized, stored := range owners {
+		if len(stored) > 1 {
+			sort.Strings(stored)
+			collisions = append(collisions, normalized+" ("+strings.Join(stored, ", ")+")")
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("%w: %s", ErrEmailCollision, strings.Join(collisions, "; "))
+	}
+	return changed, nil
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type emailsTestSuite struct {
+	suite.Suite
+}
+
+func TestEmailsSuiteRun(t *testing.T) {
+	suite.Run(t, new(emailsTestSuite))
+}
+
+func (suite *emailsTestSuite) Test_NormalizeEmails(){
+	changed, err := normalizeEmails(map[string]string{
+		"first":  " User@Пример.рф",
+		"second": "user@test.test",
+		"third":  "not an email",
+	})
+	suite.Require().NoError(err)
+	suite.Equal(map[string]string{"first": "user@xn--e1afmkfd.xn--p1ai"}, changed)
+
+	_, err = normalizeEmails(map[string]string{
+		"first":  "User@Test.Test",
+		"second": "user@test.test",
+	})
+	suite.ErrorIs(err, ErrEmailCollision)
+}
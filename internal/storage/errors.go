@@ -7,5 +7,10 @@ var (
 	ErrCollNotExist = errors.New("collection does not exist")
 	ErrUserExist    = errors.New("user already exist")
 	ErrUserNotFound = errors.New("user not found")
+	ErrSessionExist = errors.New("session already exist")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionConflict = errors.New("session was changed concurrently")
 	ErrUpdate = errors.New("error while update")
-)
\ No newline at end of file
+	ErrMigration = errors.New("error while migrating")
+	ErrEmailCollision = errors.New("emails of different users are equal after normalization")
+)
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+)
+
+type memoryProvider struct {
+	mu       sync.RWMutex
+	users    map[string]models.User
+	emails   map[string]string
+	sessions map[string]models.Session
+	// selectors maps selector of the current and rotated refresh tokens to the session id.
+	selectors map[string]string
+}
+
+// NewMemoryProvider creates storage living in the process memory.
+// Data is lost on restart, so it is suitable only for tests and local development.
+// Expired sessions are removed every cleanupInterval until ctx is done.
+func NewMemoryProvider(ctx context.Context, cleanupInterval time.Duration) *memoryProvider {
+	m := &memoryProvider{
+		users:     make(map[string]models.User),
+		emails:    make(map[string]string),
+		sessions:  make(map[string]models.Session),
+		selectors: make(map[string]string),
+	}
+	if cleanupInterval > 0 {
+		go m.cleanup(ctx, cleanupInterval)
+	}
+	return m
+}
+
+func (m *memoryProvider) SaveUser(ctx context.Context, user *models.User) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.emails[user.Email]; ok {
+		return ErrUserExist
+	}
+	if _, ok := m.users[user.UUID]; ok {
+		return ErrUserExist
+	}
+	m.users[user.UUID] = *user
+	m.emails[user.Email] = user.UUID
+	return nil
+}
+
+func (m *memoryProvider) GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.users[uuid]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &found, nil
+}
+
+func (m *memoryProvider) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	uuid, ok := m.emails[email]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := m.users[uuid]
+	return &found, nil
+}
+
+func (m *memoryProvider) UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[uuid]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.PasswordHash = passwordHash
+	m.users[uuid] = user
+	return nil
+}
+
+func (m *memoryProvider) RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[uuid]
+	if !ok {
+		return 0, ErrUserNotFound
+	}
+	if user.LastFailedAt < notBefore {
+		user.FailedAttempts = 0
+	}
+	user.FailedAttempts++
+	user.LastFailedAt = now
+	m.users[uuid] = user
+	return user.FailedAttempts, nil
+}
+
+func (m *memoryProvider) LockUser(ctx context.Context, uuid string, until int64) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[uuid]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.LockedUntil = max(user.LockedUntil, until)
+	m.users[uuid] = user
+	return nil
+}
+
+func (m *memoryProvider) ResetFailedAttempts(ctx context.Context, uuid string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[uuid]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.FailedAttempts, user.LastFailedAt, user.LockedUntil = 0, 0, 0
+	m.users[uuid] = user
+	return nil
+}
+
+func (m *memoryProvider) SaveSession(ctx context.Context, session *models.Session) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[session.Id]; ok {
+		return ErrSessionExist
+	}
+	m.putSession(session)
+	return nil
+}
+
+func (m *memoryProvider) GetSession(ctx context.Context, sessionId string) (session *models.Session, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found, ok := m.sessions[sessionId]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return copySession(found), nil
+}
+
+func (m *memoryProvider) GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessionId, ok := m.selectors[selector]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return copySession(m.sessions[sessionId]), nil
+}
+
+// UpdateSession checks the generation and replaces selectors under the write lock.
+func (m *memoryProvider) UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.sessions[session.Id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if stored.Generation != expectedGeneration || stored.RevokedAt != 0 {
+		return ErrSessionConflict
+	}
+	delete(m.selectors, stored.RefreshSelector)
+	for _, used := range stored.UsedRefreshes {
+		delete(m.selectors, used.Selector)
+	}
+	m.putSession(session)
+	return nil
+}
+
+func (m *memoryProvider) RevokeSession(ctx context.Context, sessionId string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionId]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.RevokedAt = time.Now().Unix()
+	m.sessions[sessionId] = session
+	return nil
+}
+
+func (m *memoryProvider) RevokeUserSessions(ctx context.Context, uuid string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	for id, session := range m.sessions {
+		if session.UUID == uuid && session.RevokedAt == 0 {
+			session.RevokedAt = now
+			m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (m *memoryProvider) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.removeExpired(now)
+		}
+	}
+}
+
+// removeExpired removes expired sessions together with selectors of their refresh tokens.
+func (m *memoryProvider) removeExpired(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.sessions {
+		if session.ExpiresAt > now.Unix() {
+			continue
+		}
+		delete(m.selectors, session.RefreshSelector)
+		for _, used := range session.UsedRefreshes {
+			delete(m.selectors, used.Selector)
+		}
+		delete(m.sessions, id)
+	}
+}
+
+// putSession stores copy of the session and indexes its selectors.
+// m.mu must be held.
+func (m *memoryProvider) putSession(session *models.Session) {
+	stored := copySession(*session)
+	m.sessions[stored.Id] = *stored
+	m.selectors[stored.RefreshSelector] = stored.Id
+	for _, used := range stored.UsedRefreshes {
+		m.selectors[used.Selector] = stored.Id
+	}
+}
+
+// copySession copies the session, so callers can not change stored one.
+func copySession(session models.Session) *models.Session {
+	session.UsedRefreshes = append([]models.UsedRefresh{}, session.UsedRefreshes...)
+	return &session
+}
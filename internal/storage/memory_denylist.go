@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryDenylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// NewMemoryDenylist creates denylist living in the process memory.
+// Expired entries are removed every cleanupInterval until ctx is done.
+// It is suitable only for a single instance of the service.
+func NewMemoryDenylist(ctx context.Context, cleanupInterval time.Duration) *memoryDenylist {
+	d := &memoryDenylist{
+		entries: make(map[string]time.Time),
+	}
+	if cleanupInterval > 0 {
+		go d.cleanup(ctx, cleanupInterval)
+	}
+	return d
+}
+
+func (d *memoryDenylist) Deny(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[jti] = expiresAt
+	return nil
+}
+
+func (d *memoryDenylist) IsDenied(ctx context.Context, jti string) (denied bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiresAt, ok := d.entries[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (d *memoryDenylist) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.mu.Lock()
+			for jti, expiresAt := range d.entries {
+				if !now.Before(expiresAt) {
+					delete(d.entries, jti)
+				}
+			}
+			d.mu.Unlock()
+		}
+	}
+}
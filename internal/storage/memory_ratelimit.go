@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// fullAt is time when the bucket is refilled, so it can be forgotten.
+	fullAt time.Time
+}
+
+// NewMemoryRateLimiter creates rate limit buckets living in the process memory.
+// Refilled buckets are removed every cleanupInterval until ctx is done.
+// Every instance of the service has its own buckets.
+func NewMemoryRateLimiter(ctx context.Context, cleanupInterval time.Duration) *memoryRateLimiter {
+	l := &memoryRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+	}
+	if cleanupInterval > 0 {
+		go l.cleanup(ctx, cleanupInterval)
+	}
+	return l
+}
+
+func (l *memoryRateLimiter) TakeToken(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens: float64(burst),
+			updatedAt: now,
+		}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		allowed = true
+	} else {
+		retryAfter = time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.fullAt = now.Add(time.Duration((float64(burst) - bucket.tokens) / rate * float64(time.Second)))
+	return allowed, retryAfter, nil
+}
+
+func (l *memoryRateLimiter) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, bucket := range l.buckets {
+				if !now.Before(bucket.fullAt) {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
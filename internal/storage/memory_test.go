@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type memoryTestSuite struct {
+	suite.Suite
+	ctx      context.Context
+	provider *memoryProvider
+}
+
+func TestMemorySuiteRun(t *testing.T) {
+	suite.Run(t, new(memoryTestSuite))
+}
+
+func (suite *memoryTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.provider = NewMemoryProvider(suite.ctx, 0)
+}
+
+func (suite *memoryTestSuite) Test_SaveUserDuplicateEmail(){
+	user := &models.User{Email: "test@test.test", UUID: uuid.NewString()}
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, user))
+	err := suite.provider.SaveUser(suite.ctx, &models.User{Email: user.Email, UUID: uuid.NewString()})
+	suite.ErrorIs(err, ErrUserExist)
+}
+
+func (suite *memoryTestSuite) Test_GetUserNotFound(){
+	_, err := suite.provider.GetUserByUUID(suite.ctx, uuid.NewString())
+	suite.ErrorIs(err, ErrUserNotFound)
+	_, err = suite.provider.GetUserByEmail(suite.ctx, "missing@test.test")
+	suite.ErrorIs(err, ErrUserNotFound)
+	err = suite.provider.UpdatePasswordHash(suite.ctx, uuid.NewString(), "hash")
+	suite.ErrorIs(err, ErrUserNotFound)
+}
+
+func (suite *memoryTestSuite) Test_UpdatePasswordHash(){
+	user := &models.User{Email: "test@test.test", UUID: uuid.NewString(), PasswordHash: "old"}
+	suite.Require().NoError(suite.provider.SaveUser(suite.ctx, user))
+	suite.Require().NoError(suite.provider.UpdatePasswordHash(suite.ctx, user.UUID, "new"))
+	found, err := suite.provider.GetUserByEmail(suite.ctx, user.Email)
+	suite.Require().NoError(err)
+	suite.Equal("new", found.PasswordHash)
+}
+
+func (suite *memoryTestSuite) Test_SessionSelectorIndex(){
+	session := &models.Session{
+		Id: uuid.NewString(),
+		UUID: uuid.NewString(),
+		RefreshSelector: "first",
+		RefreshDigest: "first_digest",
+	}
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, session))
+	suite.ErrorIs(suite.provider.SaveSession(suite.ctx, session), ErrSessionExist)
+
+	found, err := suite.provider.GetSessionBySelector(suite.ctx, "first")
+	suite.Require().NoError(err)
+	found.UsedRefreshes = append(found.UsedRefreshes, models.UsedRefresh{Selector: "first", Digest: "first_digest"})
+	found.RefreshSelector = "second"
+	found.Generation++
+	suite.Require().NoError(suite.provider.UpdateSession(suite.ctx, found, 0))
+
+	for _, selector := range []string{"first", "second"} {
+		found, err = suite.provider.GetSessionBySelector(suite.ctx, selector)
+		suite.Require().NoError(err, selector)
+		suite.Equal(session.Id, found.Id)
+		suite.Equal(int64(1), found.Generation)
+	}
+	_, err = suite.provider.GetSessionBySelector(suite.ctx, "unknown")
+	suite.ErrorIs(err, ErrSessionNotFound)
+}
+
+func (suite *memoryTestSuite) Test_RevokeUserSessions(){
+	userUUID := uuid.NewString()
+	ids := []string{uuid.NewString(), uuid.NewString()}
+	for i, id := range ids {
+		suite.Require().NoError(suite.provider.SaveSession(suite.ctx, &models.Session{
+			Id: id,
+			UUID: userUUID,
+			RefreshSelector: uuid.NewString(),
+			RevokedAt: int64(i),
+		}))
+	}
+	suite.Require().NoError(suite.provider.RevokeUserSessions(suite.ctx, userUUID))
+	first, err := suite.provider.GetSession(suite.ctx, ids[0])
+	suite.Require().NoError(err)
+	suite.NotZero(first.RevokedAt)
+	second, err := suite.provider.GetSession(suite.ctx, ids[1])
+	suite.Require().NoError(err)
+	suite.Equal(int64(1), second.RevokedAt)
+	suite.ErrorIs(suite.provider.RevokeSession(suite.ctx, uuid.NewString()), ErrSessionNotFound)
+}
+
+func (suite *memoryTestSuite) Test_ReturnedSessionIsCopy(){
+	session := &models.Session{Id: uuid.NewString(), RefreshSelector: "selector"}
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, session))
+	found, err := suite.provider.GetSession(suite.ctx, session.Id)
+	suite.Require().NoError(err)
+	found.RevokedAt = 1
+	found, err = suite.provider.GetSession(suite.ctx, session.Id)
+	suite.Require().NoError(err)
+	suite.Zero(found.RevokedAt)
+}
+
+
+func (suite *memoryTestSuite) Test_RateLimiterBucket(){
+	limiter := NewMemoryRateLimiter(suite.ctx, 0)
+	// one token per 100ms, so the bucket is not refilled during the test
+	for i := 0; i < 2; i++ {
+		allowed, _, err := limiter.TakeToken(suite.ctx, "key", 10, 2)
+		suite.Require().NoError(err)
+		suite.True(allowed)
+	}
+	allowed, retryAfter, err := limiter.TakeToken(suite.ctx, "key", 10, 2)
+	suite.Require().NoError(err)
+	suite.False(allowed)
+	suite.InDelta(100*time.Millisecond, retryAfter, float64(20*time.Millisecond))
+
+	allowed, _, err = limiter.TakeToken(suite.ctx, "other", 10, 2)
+	suite.Require().NoError(err)
+	suite.True(allowed)
+
+	time.Sleep(retryAfter)
+	allowed, _, err = limiter.TakeToken(suite.ctx, "key", 10, 2)
+	suite.Require().NoError(err)
+	suite.True(allowed)
+}
+
+func (suite *memoryTestSuite) Test_RemoveExpiredSessions(){
+	now := time.Now()
+	expired := &models.Session{
+		Id: uuid.NewString(),
+		RefreshSelector: "expired",
+		UsedRefreshes: []models.UsedRefresh{{Selector: "expired_used"}},
+		ExpiresAt: now.Add(-time.Second).Unix(),
+	}
+	active := &models.Session{Id: uuid.NewString(), RefreshSelector: "active", ExpiresAt: now.Add(time.Hour).Unix()}
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, expired))
+	suite.Require().NoError(suite.provider.SaveSession(suite.ctx, active))
+
+	suite.provider.removeExpired(now)
+	_, err := suite.provider.GetSession(suite.ctx, expired.Id)
+	suite.ErrorIs(err, ErrSessionNotFound)
+	_, err = suite.provider.GetSessionBySelector(suite.ctx, "expired_used")
+	suite.ErrorIs(err, ErrSessionNotFound)
+	_, err = suite.provider.GetSessionBySelector(suite.ctx, "active")
+	suite.NoError(err)
+	suite.Len(suite.provider.selectors, 1)
+}
@@ -0,0 +1,36 @@
+CREATE TABLE users (
+    uuid          TEXT PRIMARY KEY,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE sessions (
+    id               TEXT PRIMARY KEY,
+    uuid             TEXT NOT NULL,
+    device           TEXT NOT NULL DEFAULT '',
+    refresh_selector TEXT NOT NULL UNIQUE,
+    refresh_digest   TEXT NOT NULL,
+    generation       BIGINT NOT NULL DEFAULT 0,
+    created_at       BIGINT NOT NULL,
+    last_used_at     BIGINT NOT NULL,
+    expires_at       BIGINT NOT NULL,
+    revoked_at       BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX sessions_uuid_idx ON sessions (uuid);
+
+CREATE TABLE used_refresh_tokens (
+    selector   TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    digest     TEXT NOT NULL,
+    position   INTEGER NOT NULL
+);
+
+CREATE INDEX used_refresh_tokens_session_id_idx ON used_refresh_tokens (session_id);
+
+CREATE TABLE denylist (
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX denylist_expires_at_idx ON denylist (expires_at);
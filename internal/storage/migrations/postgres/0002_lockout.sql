@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_failed_at  BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until    BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,30 @@
+-- Users were registered before requests were validated, so stored emails
+-- are case folded to be found by normalized lookups. Punycode conversion
+-- is not available in SQL, so addresses with non-ASCII characters and
+-- addresses which become equal must be fixed by hand before migrating.
+DO $$
+DECLARE
+    found TEXT;
+BEGIN
+    SELECT string_agg(email, ', ') INTO found
+    FROM users
+    WHERE email ~ '[^\x01-\x7f]';
+    IF found IS NOT NULL THEN
+        RAISE EXCEPTION 'emails with non-ASCII characters must be normalized by hand: %', found;
+    END IF;
+
+    SELECT string_agg(normalized, ', ') INTO found
+    FROM (
+        SELECT lower(btrim(email, E' \t\n\r\x0B\f')) AS normalized
+        FROM users
+        GROUP BY 1
+        HAVING count(*) > 1
+    ) AS collisions;
+    IF found IS NOT NULL THEN
+        RAISE EXCEPTION 'emails of different users are equal after normalization: %', found;
+    END IF;
+END $$;
+
+UPDATE users
+SET email = lower(btrim(email, E' \t\n\r\x0B\f'))
+WHERE email <> lower(btrim(email, E' \t\n\r\x0B\f'));
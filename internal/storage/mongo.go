@@ -2,34 +2,32 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/EwvwGeN/medods_assignment/internal/config"
 	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/EwvwGeN/medods_assignment/internal/storage")
+
 type mongoProvider struct {
 	cfg config.MongoConfig
 	db  *mongo.Database
 }
 
+// NewMongoProvider connects to mongo. Collections must already exist,
+// unless cfg.AutoMigrate is set and they are created by migrations.
 func NewMongoProvider(ctx context.Context, cfg config.MongoConfig) (*mongoProvider, error) {
-	client, err := mongo.Connect(ctx,
-		options.Client().
-			ApplyURI(
-				fmt.Sprintf("%s://%s:%s@%s:%s/?authSource=%s",
-					cfg.ConectionFormat,
-					cfg.User,
-					cfg.Password,
-					cfg.Host,
-					cfg.Port,
-					cfg.AuthSourse,
-				)),
-	)
+	client, err := connectMongo(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -37,16 +35,23 @@ func NewMongoProvider(ctx context.Context, cfg config.MongoConfig) (*mongoProvid
 	if err != nil {
 		return nil, err
 	}
-	if dbList.TotalSize == 0 {
+	if dbList.TotalSize == 0 && !cfg.AutoMigrate {
 		return nil, ErrDbNotExist
 	}
 	db := client.Database(cfg.Database)
-	colList, err := db.ListCollectionNames(ctx, bson.D{{Key: "name", Value: cfg.UserCollection}})
-	if err != nil {
-		return nil, err
+	if cfg.AutoMigrate {
+		if _, err = migrateMongo(ctx, db, cfg); err != nil {
+			return nil, err
+		}
 	}
-	if len(colList) != 1 {
-		return nil, ErrCollNotExist
+	for _, collection := range []string{cfg.UserCollection, cfg.SessionCollection, cfg.DenylistCollection} {
+		colList, err := db.ListCollectionNames(ctx, bson.D{{Key: "name", Value: collection}})
+		if err != nil {
+			return nil, err
+		}
+		if len(colList) != 1 {
+			return nil, fmt.Errorf("%w: %s", ErrCollNotExist, collection)
+		}
 	}
 	return &mongoProvider{
 		cfg: cfg,
@@ -54,10 +59,40 @@ func NewMongoProvider(ctx context.Context, cfg config.MongoConfig) (*mongoProvid
 	}, nil
 }
 
-func (m *mongoProvider) SaveUser(ctx context.Context, email, uuid string) (err error) {
+func connectMongo(ctx context.Context, cfg config.MongoConfig) (*mongo.Client, error) {
+	return mongo.Connect(ctx,
+		options.Client().
+			ApplyURI(
+				fmt.Sprintf("%s://%s:%s@%s:%s/?authSource=%s",
+					cfg.ConectionFormat,
+					cfg.User,
+					cfg.Password,
+					cfg.Host,
+					cfg.Port,
+					cfg.AuthSourse,
+				)),
+	)
+}
+
+// startSpan starts span of the provider method working with collection.
+func (m *mongoProvider) startSpan(ctx context.Context, method, collection string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "mongo."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBName(m.cfg.Database),
+			semconv.DBMongoDBCollection(collection),
+		),
+	)
+}
+
+func (m *mongoProvider) SaveUser(ctx context.Context, user *models.User) (err error) {
+	ctx, span := m.startSpan(ctx, "SaveUser", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
 	_, err = m.db.Collection(m.cfg.UserCollection).InsertOne(ctx, bson.D{
-		{Key: "email", Value: email},
-		{Key: "uuid", Value: uuid},
+		{Key: "email", Value: user.Email},
+		{Key: "uuid", Value: user.UUID},
+		{Key: "password_hash", Value: user.PasswordHash},
 	})
 	if mongo.IsDuplicateKeyError(err) {
 		return ErrUserExist
@@ -66,30 +101,341 @@ func (m *mongoProvider) SaveUser(ctx context.Context, email, uuid string) (err e
 }
 
 func (m *mongoProvider) GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error) {
+	ctx, span := m.startSpan(ctx, "GetUserByUUID", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
 	findedUser := m.db.Collection(m.cfg.UserCollection).FindOne(ctx, bson.D{{Key: "uuid", Value: uuid}})
-	if raw, _ := findedUser.Raw(); raw != nil {
-		findedUser.Decode(&user)
-		return user, nil
+	if err = findedUser.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	user = &models.User{}
+	if err = findedUser.Decode(user); err != nil {
+		return nil, err
 	}
-	return &models.User{}, ErrUserNotFound
+	return user, nil
 }
 
-func (m *mongoProvider) SaveRefreshToken(ctx context.Context, uuid, refresh string, refreshTTL time.Duration) (err error) {
-	findedUser := m.db.Collection(m.cfg.UserCollection).FindOne(ctx, bson.D{{Key: "uuid", Value: uuid}})
-	if raw, _ := findedUser.Raw(); raw == nil {
+func (m *mongoProvider) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	ctx, span := m.startSpan(ctx, "GetUserByEmail", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
+	findedUser := m.db.Collection(m.cfg.UserCollection).FindOne(ctx, bson.D{{Key: "email", Value: email}})
+	if err = findedUser.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	user = &models.User{}
+	if err = findedUser.Decode(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (m *mongoProvider) UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error) {
+	ctx, span := m.startSpan(ctx, "UpdatePasswordHash", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
+	return m.updateUser(ctx, uuid, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "password_hash", Value: passwordHash}},
+		},
+	})
+}
+
+func (m *mongoProvider) RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error) {
+	ctx, span := m.startSpan(ctx, "RecordFailedAttempt", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
+	// pipeline update reads and changes the counter atomically
+	stale := bson.D{{Key: "$lt", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$last_failed_at", int64(0)}}}, notBefore,
+	}}}
+	user := models.User{}
+	err = m.db.Collection(m.cfg.UserCollection).FindOneAndUpdate(ctx, bson.D{
+		{Key: "uuid", Value: uuid},
+	},
+	mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "failed_attempts", Value: bson.D{{Key: "$cond", Value: bson.A{
+				stale, 1, bson.D{{Key: "$add", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$failed_attempts", 0}}}, 1,
+				}}},
+			}}}},
+			{Key: "last_failed_at", Value: now},
+		}}},
+	},
+	options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return user.FailedAttempts, nil
+}
+
+func (m *mongoProvider) LockUser(ctx context.Context, uuid string, until int64) (err error) {
+	ctx, span := m.startSpan(ctx, "LockUser", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
+	return m.updateUser(ctx, uuid, bson.D{
+		{Key: "$max", Value: bson.D{
+			{Key: "locked_until", Value: until}},
+		},
+	})
+}
+
+func (m *mongoProvider) ResetFailedAttempts(ctx context.Context, uuid string) (err error) {
+	ctx, span := m.startSpan(ctx, "ResetFailedAttempts", m.cfg.UserCollection)
+	defer tracing.End(span, &err)
+	return m.updateUser(ctx, uuid, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "failed_attempts", Value: 0},
+			{Key: "last_failed_at", Value: int64(0)},
+			{Key: "locked_until", Value: int64(0)}},
+		},
+	})
+}
+
+func (m *mongoProvider) updateUser(ctx context.Context, uuid string, update bson.D) (err error) {
+	res, err := m.db.Collection(m.cfg.UserCollection).UpdateOne(ctx, bson.D{
+		{Key: "uuid", Value: uuid},
+	}, update)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if res.MatchedCount == 0 {
 		return ErrUserNotFound
 	}
-	_, err = m.db.Collection(m.cfg.UserCollection).UpdateOne(ctx, bson.D{
+	return
+}
+
+// mongoSession is the stored session. TTL index works only with dates,
+// so the expiration time is duplicated as delete_at to remove expired sessions.
+type mongoSession struct {
+	models.Session `bson:",inline"`
+	DeleteAt       time.Time `bson:"delete_at"`
+}
+
+func newMongoSession(session *models.Session) *mongoSession {
+	return &mongoSession{
+		Session: *session,
+		DeleteAt: time.Unix(session.ExpiresAt, 0),
+	}
+}
+
+func (m *mongoProvider) SaveSession(ctx context.Context, session *models.Session) (err error) {
+	ctx, span := m.startSpan(ctx, "SaveSession", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	_, err = m.db.Collection(m.cfg.SessionCollection).InsertOne(ctx, newMongoSession(session))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrSessionExist
+	}
+	return
+}
+
+func (m *mongoProvider) GetSession(ctx context.Context, sessionId string) (session *models.Session, err error) {
+	ctx, span := m.startSpan(ctx, "GetSession", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	findedSession := m.db.Collection(m.cfg.SessionCollection).FindOne(ctx, bson.D{{Key: "_id", Value: sessionId}})
+	if err = findedSession.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	session = &models.Session{}
+	if err = findedSession.Decode(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionBySelector matches the current selector and selectors of used_refresh_tokens.
+func (m *mongoProvider) GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error) {
+	ctx, span := m.startSpan(ctx, "GetSessionBySelector", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	findedSession := m.db.Collection(m.cfg.SessionCollection).FindOne(ctx, bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "refresh_selector", Value: selector}},
+			bson.D{{Key: "used_refresh_tokens.selector", Value: selector}},
+		}},
+	})
+	if err = findedSession.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	session = &models.Session{}
+	if err = findedSession.Decode(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// UpdateSession puts the generation check into the filter of ReplaceOne, so the check
+// and the write are atomic. When nothing matched, the session is counted to tell
+// a missing session from a conflict.
+func (m *mongoProvider) UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error) {
+	ctx, span := m.startSpan(ctx, "UpdateSession", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	collection := m.db.Collection(m.cfg.SessionCollection)
+	res, err := collection.ReplaceOne(ctx, bson.D{
+		{Key: "_id", Value: session.Id},
+		{Key: "generation", Value: expectedGeneration},
+		{Key: "revoked_at", Value: 0},
+	}, newMongoSession(session))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if res.MatchedCount == 0 {
+		count, err := collection.CountDocuments(ctx, bson.D{{Key: "_id", Value: session.Id}})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUpdate, err)
+		}
+		if count == 0 {
+			return ErrSessionNotFound
+		}
+		return ErrSessionConflict
+	}
+	return
+}
+
+func (m *mongoProvider) RevokeSession(ctx context.Context, sessionId string) (err error) {
+	ctx, span := m.startSpan(ctx, "RevokeSession", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	res, err := m.db.Collection(m.cfg.SessionCollection).UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: sessionId},
+	},
+	bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "revoked_at", Value: time.Now().Unix()}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return
+}
+
+func (m *mongoProvider) RevokeUserSessions(ctx context.Context, uuid string) (err error) {
+	ctx, span := m.startSpan(ctx, "RevokeUserSessions", m.cfg.SessionCollection)
+	defer tracing.End(span, &err)
+	_, err = m.db.Collection(m.cfg.SessionCollection).UpdateMany(ctx, bson.D{
 		{Key: "uuid", Value: uuid},
+		{Key: "revoked_at", Value: 0},
 	},
 	bson.D{
 		{Key: "$set", Value: bson.D{
-			{Key: "refresh_token", Value: refresh},
-			{Key: "expires_at", Value: time.Now().Add(refreshTTL).Unix()}},
+			{Key: "revoked_at", Value: time.Now().Unix()}},
 		},
 	})
 	if err != nil {
-		return ErrUpdate
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
 	}
 	return
 }
+
+func (m *mongoProvider) Deny(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	ctx, span := m.startSpan(ctx, "Deny", m.cfg.DenylistCollection)
+	defer tracing.End(span, &err)
+	_, err = m.db.Collection(m.cfg.DenylistCollection).UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: jti},
+	},
+	bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "expires_at", Value: expiresAt}},
+		},
+	},
+	options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return
+}
+
+// IsDenied also checks expiration time by itself, because
+// mongo removes expired documents only once per minute.
+func (m *mongoProvider) IsDenied(ctx context.Context, jti string) (denied bool, err error) {
+	ctx, span := m.startSpan(ctx, "IsDenied", m.cfg.DenylistCollection)
+	defer tracing.End(span, &err)
+	err = m.db.Collection(m.cfg.DenylistCollection).FindOne(ctx, bson.D{
+		{Key: "_id", Value: jti},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// TakeToken updates the bucket with single pipeline update, so concurrent
+// requests of all instances see consistent number of tokens. Time of the
+// mongo server is used, so clocks of instances do not affect refilling.
+func (m *mongoProvider) TakeToken(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error) {
+	ctx, span := m.startSpan(ctx, "TakeToken", rateLimitCollection(m.cfg))
+	defer tracing.End(span, &err)
+	sinceUpdate := bson.D{{Key: "$subtract", Value: bson.A{
+		"$$NOW", bson.D{{Key: "$ifNull", Value: bson.A{"$updated_at", "$$NOW"}}},
+	}}}
+	refilled := bson.D{{Key: "$add", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", float64(burst)}}},
+		bson.D{{Key: "$multiply", Value: bson.A{
+			bson.D{{Key: "$divide", Value: bson.A{sinceUpdate, 1000}}}, rate,
+		}}},
+	}}}
+	hasToken := bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: bson.D{{Key: "$min", Value: bson.A{float64(burst), refilled}}}},
+			{Key: "updated_at", Value: "$$NOW"},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "allowed", Value: hasToken},
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{
+				hasToken, bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens",
+			}}}},
+			// bucket is removed by ttl index when it is refilled
+			{Key: "expires_at", Value: bson.D{{Key: "$add", Value: bson.A{
+				"$$NOW", int64(float64(burst) / rate * 1000),
+			}}}},
+		}}},
+	}
+	bucket := struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}{}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	for attempt := 0; attempt < 2; attempt++ {
+		err = m.db.Collection(rateLimitCollection(m.cfg)).FindOneAndUpdate(ctx, bson.D{
+			{Key: "_id", Value: key},
+		}, pipeline, opts).Decode(&bucket)
+		// concurrent upserts of the new bucket can conflict, the update is retried once
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if !bucket.Allowed {
+		retryAfter = time.Duration((1 - bucket.Tokens) / rate * float64(time.Second))
+	}
+	return bucket.Allowed, retryAfter, nil
+}
+
+// rateLimitCollection returns name of the rate limit collection, it has default
+// name, so configs written before rate limiting was added still can be migrated.
+func rateLimitCollection(cfg config.MongoConfig) string {
+	if cfg.RateLimitCollection == "" {
+		return "rate_limit"
+	}
+	return cfg.RateLimitCollection
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigrationsCollection keeps versions of applied migrations.
+const mongoMigrationsCollection = "schema_migrations"
+
+// namespaceExistsCode is mongo error code returned when collection already exists.
+const namespaceExistsCode = 48
+
+// Every migration must be idempotent: mongo has no transactional DDL,
+// so migration interrupted before its version was recorded is applied again.
+type mongoMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error
+}
+
+var mongoMigrations = []mongoMigration{
+	{1, "create_users", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		err := ensureCollection(ctx, db, cfg.UserCollection, bson.M{
+			"bsonType": "object",
+			"required": bson.A{"email", "uuid"},
+			"properties": bson.M{
+				"email":         bson.M{"bsonType": "string"},
+				"uuid":          bson.M{"bsonType": "string"},
+				"password_hash": bson.M{"bsonType": "string"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection(cfg.UserCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "uuid", Value: 1}}, Options: options.Index().SetUnique(true)},
+		})
+		return err
+	}},
+	{2, "create_sessions", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		err := ensureCollection(ctx, db, cfg.SessionCollection, bson.M{
+			"bsonType": "object",
+			"required": bson.A{"uuid", "refresh_selector", "refresh_digest", "expires_at"},
+			"properties": bson.M{
+				"uuid":             bson.M{"bsonType": "string"},
+				"device":           bson.M{"bsonType": "string"},
+				"refresh_selector": bson.M{"bsonType": "string"},
+				"refresh_digest":   bson.M{"bsonType": "string"},
+				"generation":       bson.M{"bsonType": "long"},
+				"used_refresh_tokens": bson.M{
+					"bsonType": "array",
+					"items": bson.M{
+						"bsonType": "object",
+						"required": bson.A{"selector", "digest"},
+						"properties": bson.M{
+							"selector": bson.M{"bsonType": "string"},
+							"digest":   bson.M{"bsonType": "string"},
+						},
+					},
+				},
+				"created_at":   bson.M{"bsonType": "long"},
+				"last_used_at": bson.M{"bsonType": "long"},
+				"expires_at":   bson.M{"bsonType": "long"},
+				"revoked_at":   bson.M{"bsonType": "long"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection(cfg.SessionCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "uuid", Value: 1}}},
+			{Keys: bson.D{{Key: "refresh_selector", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "used_refresh_tokens.selector", Value: 1}}},
+		})
+		return err
+	}},
+	{3, "create_denylist", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		err := ensureCollection(ctx, db, cfg.DenylistCollection, bson.M{
+			"bsonType": "object",
+			"required": bson.A{"expires_at"},
+			"properties": bson.M{
+				"expires_at": bson.M{"bsonType": "date"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		// mongo removes documents once expires_at is passed
+		_, err = db.Collection(cfg.DenylistCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		return err
+	}},
+	{4, "create_rate_limits", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		err := ensureCollection(ctx, db, rateLimitCollection(cfg), bson.M{
+			"bsonType": "object",
+			"required": bson.A{"tokens", "updated_at", "expires_at"},
+			"properties": bson.M{
+				"tokens":     bson.M{"bsonType": "double"},
+				"allowed":    bson.M{"bsonType": "bool"},
+				"updated_at": bson.M{"bsonType": "date"},
+				"expires_at": bson.M{"bsonType": "date"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = db.Collection(rateLimitCollection(cfg)).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		return err
+	}},
+	{5, "add_user_lockout", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		return ensureCollection(ctx, db, cfg.UserCollection, bson.M{
+			"bsonType": "object",
+			"required": bson.A{"email", "uuid"},
+			"properties": bson.M{
+				"email":           bson.M{"bsonType": "string"},
+				"uuid":            bson.M{"bsonType": "string"},
+				"password_hash":   bson.M{"bsonType": "string"},
+				"failed_attempts": bson.M{"bsonType": bson.A{"int", "long"}},
+				"last_failed_at":  bson.M{"bsonType": bson.A{"int", "long"}},
+				"locked_until":    bson.M{"bsonType": bson.A{"int", "long"}},
+			},
+		})
+	}},
+	{6, "normalize_emails", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		users := db.Collection(cfg.UserCollection)
+		cursor, err := users.Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{
+			{Key: "uuid", Value: 1},
+			{Key: "email", Value: 1},
+		}))
+		if err != nil {
+			return err
+		}
+		var found []models.User
+		if err = cursor.All(ctx, &found); err != nil {
+			return err
+		}
+		emails := make(map[string]string, len(found))
+		for _, user := range found {
+			emails[user.UUID] = user.Email
+		}
+		changed, err := normalizeEmails(emails)
+		if err != nil {
+			return err
+		}
+		for uuid, email := range changed {
+			_, err = users.UpdateOne(ctx,
+				bson.D{{Key: "uuid", Value: uuid}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: email}}}})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{7, "expire_sessions", func(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) error {
+		err := ensureCollection(ctx, db, cfg.SessionCollection, bson.M{
+			"bsonType": "object",
+			"required": bson.A{"uuid", "refresh_selector", "refresh_digest", "expires_at"},
+			"properties": bson.M{
+				"uuid":             bson.M{"bsonType": "string"},
+				"device":           bson.M{"bsonType": "string"},
+				"refresh_selector": bson.M{"bsonType": "string"},
+				"refresh_digest":   bson.M{"bsonType": "string"},
+				"generation":       bson.M{"bsonType": "long"},
+				"used_refresh_tokens": bson.M{
+					"bsonType": "array",
+					"items": bson.M{
+						"bsonType": "object",
+						"required": bson.A{"selector", "digest"},
+						"properties": bson.M{
+							"selector": bson.M{"bsonType": "string"},
+							"digest":   bson.M{"bsonType": "string"},
+						},
+					},
+				},
+				"created_at":   bson.M{"bsonType": "long"},
+				"last_used_at": bson.M{"bsonType": "long"},
+				"expires_at":   bson.M{"bsonType": "long"},
+				"revoked_at":   bson.M{"bsonType": "long"},
+				"delete_at":    bson.M{"bsonType": "date"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		sessions := db.Collection(cfg.SessionCollection)
+		// sessions saved before the migration get delete_at from expires_at in seconds
+		_, err = sessions.UpdateMany(ctx,
+			bson.D{{Key: "delete_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.D{
+					{Key: "delete_at", Value: bson.D{{Key: "$toDate", Value: bson.D{
+						{Key: "$multiply", Value: bson.A{"$expires_at", 1000}},
+					}}}},
+				}}},
+			})
+		if err != nil {
+			return err
+		}
+		// mongo removes sessions once delete_at is passed
+		_, err = sessions.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "delete_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		return err
+	}},
+}
+
+// ensureCollection creates collection with the json schema validator
+// or replaces validator of already existing one.
+func ensureCollection(ctx context.Context, db *mongo.Database, name string, schema bson.M) error {
+	names, err := db.ListCollectionNames(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return err
+	}
+	validator := bson.M{"$jsonSchema": schema}
+	if len(names) == 0 {
+		err = db.CreateCollection(ctx, name, options.CreateCollection().SetValidator(validator))
+		var cmdErr mongo.CommandError
+		// collection can be created by another instance migrating at the same time
+		if !errors.As(err, &cmdErr) || cmdErr.Code != namespaceExistsCode {
+			return err
+		}
+	}
+	return db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+	}).Err()
+}
+
+// MigrateMongo creates or upgrades collections, validators and indexes
+// and returns versions which were applied by this call.
+func MigrateMongo(ctx context.Context, cfg config.MongoConfig) (applied []int, err error) {
+	client, err := connectMongo(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(ctx)
+	return migrateMongo(ctx, client.Database(cfg.Database), cfg)
+}
+
+func migrateMongo(ctx context.Context, db *mongo.Database, cfg config.MongoConfig) (applied []int, err error) {
+	versions := db.Collection(mongoMigrationsCollection)
+	applied = []int{}
+	for _, m := range mongoMigrations {
+		err = versions.FindOne(ctx, bson.D{{Key: "_id", Value: m.version}}).Err()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return applied, err
+		}
+		if err = m.up(ctx, db, cfg); err != nil {
+			return applied, fmt.Errorf("%w: %d_%s: %s", ErrMigration, m.version, m.name, err.Error())
+		}
+		_, err = versions.UpdateOne(ctx, bson.D{
+			{Key: "_id", Value: m.version},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "name", Value: m.name},
+				{Key: "applied_at", Value: time.Now()}},
+			},
+		},
+		options.Update().SetUpsert(true))
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, m.version)
+	}
+	return applied, nil
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type mongoMigrationsTestSuite struct {
+	suite.Suite
+}
+
+func TestMongoMigrationsSuiteRun(t *testing.T) {
+	suite.Run(t, new(mongoMigrationsTestSuite))
+}
+
+func (suite *mongoMigrationsTestSuite) Test_VersionsIncrease(){
+	suite.Require().NotEmpty(mongoMigrations)
+	for i := 1; i < len(mongoMigrations); i++ {
+		suite.Less(mongoMigrations[i-1].version, mongoMigrations[i].version, mongoMigrations[i].name)
+	}
+}
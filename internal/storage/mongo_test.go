@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type mongoTestSuite struct {
+	suite.Suite
+}
+
+func TestMongoSuiteRun(t *testing.T) {
+	suite.Run(t, new(mongoTestSuite))
+}
+
+func (suite *mongoTestSuite) Test_SessionHasDeleteDate(){
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	data, err := bson.Marshal(newMongoSession(&models.Session{Id: "session", ExpiresAt: expiresAt}))
+	suite.Require().NoError(err)
+	raw := bson.Raw(data)
+	suite.Equal("session", raw.Lookup("_id").StringValue())
+	suite.Equal(expiresAt, raw.Lookup("expires_at").Int64())
+	suite.Equal(expiresAt, raw.Lookup("delete_at").Time().Unix())
+
+	session := &models.Session{}
+	suite.Require().NoError(bson.Unmarshal(data, session))
+	suite.Equal(expiresAt, session.ExpiresAt)
+}
+
+func (suite *mongoTestSuite) Test_WriteTimeoutKeepsCause(){
+	cfg := config.MongoConfig{
+		ConectionFormat: "mongodb",
+		Host: "127.0.0.1",
+		Port: "1",
+		User: "user",
+		Password: "password",
+		AuthSourse: "admin",
+		Database: "auth",
+		UserCollection: "users",
+		SessionCollection: "sessions",
+		DenylistCollection: "denylist",
+	}
+	// client connects lazily, so writes fail on the expired context before reaching the server
+	client, err := connectMongo(context.Background(), cfg)
+	suite.Require().NoError(err)
+	defer client.Disconnect(context.Background())
+	provider := &mongoProvider{cfg: cfg, db: client.Database(cfg.Database)}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	writes := map[string]error{
+		"revoke_session": provider.RevokeSession(ctx, "session"),
+		"revoke_user_sessions": provider.RevokeUserSessions(ctx, "uuid"),
+		"update_session": provider.UpdateSession(ctx, &models.Session{Id: "session"}, 0),
+		"update_password_hash": provider.UpdatePasswordHash(ctx, "uuid", "hash"),
+		"deny": provider.Deny(ctx, "jti", time.Now().Add(time.Minute)),
+	}
+	for name, err := range writes {
+		suite.ErrorIs(err, ErrUpdate, name)
+		suite.ErrorIs(err, context.DeadlineExceeded, name)
+	}
+}
@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation is postgres error code of unique constraint violation.
+const uniqueViolation = "23505"
+
+const userColumns = "uuid, email, password_hash, failed_attempts, last_failed_at, locked_until"
+
+const sessionColumns = "id, uuid, device, refresh_selector, refresh_digest, generation, created_at, last_used_at, expires_at, revoked_at"
+
+type postgresProvider struct {
+	cfg  config.PostgresConfig
+	pool *pgxpool.Pool
+}
+
+// NewPostgresProvider connects to postgres and applies schema migrations.
+// Expired sessions and denylist entries are removed every cfg.CleanupInterval until ctx is done.
+func NewPostgresProvider(ctx context.Context, cfg config.PostgresConfig) (*postgresProvider, error) {
+	poolCfg, err := pgxpool.ParseConfig(postgresURL(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	p := &postgresProvider{
+		cfg:  cfg,
+		pool: pool,
+	}
+	if _, err = migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if cfg.CleanupInterval > 0 {
+		go p.cleanup(ctx, cfg.CleanupInterval)
+	}
+	return p, nil
+}
+
+func postgresURL(cfg config.PostgresConfig) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   cfg.Host + ":" + cfg.Port,
+		Path:   "/" + cfg.Database,
+	}
+	if cfg.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+	return u.String()
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+func (p *postgresProvider) SaveUser(ctx context.Context, user *models.User) (err error) {
+	_, err = p.pool.Exec(ctx,
+		"INSERT INTO users (uuid, email, password_hash) VALUES ($1, $2, $3)",
+		user.UUID, user.Email, user.PasswordHash,
+	)
+	if isUniqueViolation(err) {
+		return ErrUserExist
+	}
+	return
+}
+
+func (p *postgresProvider) GetUserByUUID(ctx context.Context, uuid string) (user *models.User, err error) {
+	return p.getUser(ctx, "SELECT "+userColumns+" FROM users WHERE uuid = $1", uuid)
+}
+
+func (p *postgresProvider) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	return p.getUser(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email)
+}
+
+func (p *postgresProvider) getUser(ctx context.Context, query string, arg string) (user *models.User, err error) {
+	user = &models.User{}
+	err = p.pool.QueryRow(ctx, query, arg).Scan(
+		&user.UUID, &user.Email, &user.PasswordHash, &user.FailedAttempts, &user.LastFailedAt, &user.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (p *postgresProvider) UpdatePasswordHash(ctx context.Context, uuid, passwordHash string) (err error) {
+	return p.updateUser(ctx, "UPDATE users SET password_hash = $2 WHERE uuid = $1", uuid, passwordHash)
+}
+
+func (p *postgresProvider) RecordFailedAttempt(ctx context.Context, uuid string, now, notBefore int64) (attempts int, err error) {
+	err = p.pool.QueryRow(ctx, `UPDATE users SET
+		failed_attempts = CASE WHEN last_failed_at < $3 THEN 1 ELSE failed_attempts + 1 END,
+		last_failed_at = $2
+		WHERE uuid = $1 RETURNING failed_attempts`,
+		uuid, now, notBefore,
+	).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return attempts, nil
+}
+
+func (p *postgresProvider) LockUser(ctx context.Context, uuid string, until int64) (err error) {
+	return p.updateUser(ctx, "UPDATE users SET locked_until = GREATEST(locked_until, $2) WHERE uuid = $1", uuid, until)
+}
+
+func (p *postgresProvider) ResetFailedAttempts(ctx context.Context, uuid string) (err error) {
+	return p.updateUser(ctx, "UPDATE users SET failed_attempts = 0, last_failed_at = 0, locked_until = 0 WHERE uuid = $1", uuid)
+}
+
+func (p *postgresProvider) updateUser(ctx context.Context, query string, args ...any) (err error) {
+	tag, err := p.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return
+}
+
+func (p *postgresProvider) SaveSession(ctx context.Context, session *models.Session) (err error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, "INSERT INTO sessions ("+sessionColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		session.Id, session.UUID, session.Device, session.RefreshSelector, session.RefreshDigest,
+		session.Generation, session.CreatedAt, session.LastUsedAt, session.ExpiresAt, session.RevokedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrSessionExist
+		}
+		return err
+	}
+	if err = saveUsedRefreshes(ctx, tx, session); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *postgresProvider) GetSession(ctx context.Context, sessionId string) (session *models.Session, err error) {
+	return p.getSession(ctx, "id = $1", sessionId)
+}
+
+// GetSessionBySelector looks up the current selector and then rotated ones in used_refresh_tokens.
+func (p *postgresProvider) GetSessionBySelector(ctx context.Context, selector string) (session *models.Session, err error) {
+	return p.getSession(ctx, `id = (
+		SELECT id FROM sessions WHERE refresh_selector = $1
+		UNION ALL
+		SELECT session_id FROM used_refresh_tokens WHERE selector = $1
+		LIMIT 1
+	)`, selector)
+}
+
+func (p *postgresProvider) getSession(ctx context.Context, condition string, arg string) (session *models.Session, err error) {
+	session = &models.Session{}
+	err = p.pool.QueryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE "+condition, arg).Scan(
+		&session.Id, &session.UUID, &session.Device, &session.RefreshSelector, &session.RefreshDigest,
+		&session.Generation, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	rows, err := p.pool.Query(ctx,
+		"SELECT selector, digest FROM used_refresh_tokens WHERE session_id = $1 ORDER BY position",
+		session.Id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	session.UsedRefreshes, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (used models.UsedRefresh, err error) {
+		err = row.Scan(&used.Selector, &used.Digest)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// UpdateSession checks the generation in the WHERE clause and replaces used refresh tokens
+// in the same transaction.
+func (p *postgresProvider) UpdateSession(ctx context.Context, session *models.Session, expectedGeneration int64) (err error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `UPDATE sessions SET
+		uuid = $2, device = $3, refresh_selector = $4, refresh_digest = $5, generation = $6,
+		created_at = $7, last_used_at = $8, expires_at = $9, revoked_at = $10
+		WHERE id = $1 AND generation = $11 AND revoked_at = 0`,
+		session.Id, session.UUID, session.Device, session.RefreshSelector, session.RefreshDigest,
+		session.Generation, session.CreatedAt, session.LastUsedAt, session.ExpiresAt, session.RevokedAt,
+		expectedGeneration,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1)", session.Id).Scan(&exists); err != nil {
+			return fmt.Errorf("%w: %w", ErrUpdate, err)
+		}
+		if !exists {
+			return ErrSessionNotFound
+		}
+		return ErrSessionConflict
+	}
+	if _, err = tx.Exec(ctx, "DELETE FROM used_refresh_tokens WHERE session_id = $1", session.Id); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if err = saveUsedRefreshes(ctx, tx, session); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return
+}
+
+func saveUsedRefreshes(ctx context.Context, tx pgx.Tx, session *models.Session) (err error) {
+	for position, used := range session.UsedRefreshes {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO used_refresh_tokens (selector, session_id, digest, position) VALUES ($1, $2, $3, $4)",
+			used.Selector, session.Id, used.Digest, position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *postgresProvider) RevokeSession(ctx context.Context, sessionId string) (err error) {
+	tag, err := p.pool.Exec(ctx, "UPDATE sessions SET revoked_at = $2 WHERE id = $1", sessionId, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return
+}
+
+func (p *postgresProvider) RevokeUserSessions(ctx context.Context, uuid string) (err error) {
+	_, err = p.pool.Exec(ctx, "UPDATE sessions SET revoked_at = $2 WHERE uuid = $1 AND revoked_at = 0", uuid, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return
+}
+
+func (p *postgresProvider) Deny(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	_, err = p.pool.Exec(ctx, `INSERT INTO denylist (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+		jti, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUpdate, err)
+	}
+	return
+}
+
+// IsDenied also checks expiration time by itself, because
+// expired entries are removed only once per cleanup interval.
+func (p *postgresProvider) IsDenied(ctx context.Context, jti string) (denied bool, err error) {
+	err = p.pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM denylist WHERE jti = $1 AND expires_at > $2)",
+		jti, time.Now(),
+	).Scan(&denied)
+	return
+}
+
+func (p *postgresProvider) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// failed cleanup is retried on the next tick
+			p.removeExpired(ctx, now)
+		}
+	}
+}
+
+// removeExpired removes expired denylist entries and sessions,
+// rotated refresh tokens of the sessions are removed by cascade.
+func (p *postgresProvider) removeExpired(ctx context.Context, now time.Time) (err error) {
+	if _, err = p.pool.Exec(ctx, "DELETE FROM denylist WHERE expires_at <= $1", now); err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now.Unix())
+	return err
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// migrationLockId is the key of advisory lock taken while migrating,
+// so several instances starting at once do not apply the same migration.
+const migrationLockId = 7232946
+
+// txStarter is implemented by both single connection and pool.
+type txStarter interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// loadMigrations reads migrations named "<version>_<name>.sql" from dir
+// and returns them sorted by version.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]migration, 0, len(entries))
+	versions := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("%w: bad file name %s", ErrMigration, name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad version of %s", ErrMigration, name)
+		}
+		if previous, ok := versions[version]; ok {
+			return nil, fmt.Errorf("%w: %s and %s have the same version", ErrMigration, previous, name)
+		}
+		versions[version] = name
+		query, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{
+			version: version,
+			name:    name,
+			query:   string(query),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// MigratePostgres applies schema migrations and returns versions
+// which were applied by this call.
+func MigratePostgres(ctx context.Context, cfg config.PostgresConfig) (applied []int, err error) {
+	conn, err := pgx.Connect(ctx, postgresURL(cfg))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+	return migratePostgres(ctx, conn)
+}
+
+// migratePostgres applies migrations shipped in the binary which were not applied yet.
+// Everything runs in one transaction, so failed migration leaves schema untouched.
+func migratePostgres(ctx context.Context, db txStarter) (applied []int, err error) {
+	migrations, err := loadMigrations(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockId); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	appliedVersions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(appliedVersions))
+	for _, version := range appliedVersions {
+		done[version] = true
+	}
+	applied = []int{}
+	for _, m := range migrations {
+		if done[m.version] {
+			continue
+		}
+		if _, err = tx.Exec(ctx, m.query); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrMigration, m.name, err.Error())
+		}
+		if _, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m.version)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
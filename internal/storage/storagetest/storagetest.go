@@ -0,0 +1,422 @@
+// Package storagetest checks that storage implementations follow the same contract.
+//
+// Every backend runs the suite against itself:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storagetest.Repo {
+//			return storage.NewMemoryProvider(context.Background(), 0)
+//		})
+//	}
+//
+// Tests use random uuids and emails, so the backend does not have to be empty
+// and can be shared between tests.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EwvwGeN/medods_assignment/internal/domain/models"
+	"github.com/EwvwGeN/medods_assignment/internal/service"
+	"github.com/EwvwGeN/medods_assignment/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Repo is what the service needs from a storage backend.
+// Denylist tests are skipped when Repo does not implement service.TokenDenylist.
+type Repo interface {
+	service.UserRepo
+}
+
+// concurrency is how many goroutines race in concurrent tests.
+const concurrency = 16
+
+type testCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, repo Repo)
+}
+
+// Run runs every conformance test with a repo made by newRepo.
+func Run(t *testing.T, newRepo func(t *testing.T) Repo) {
+	groups := []struct {
+		name  string
+		cases []testCase
+	}{
+		{"users", userCases},
+		{"sessions", sessionCases},
+		{"denylist", denylistCases},
+		{"concurrency", concurrencyCases},
+	}
+	for _, group := range groups {
+		t.Run(group.name, func(t *testing.T) {
+			for _, tc := range group.cases {
+				t.Run(tc.name, func(t *testing.T) {
+					tc.run(t, context.Background(), newRepo(t))
+				})
+			}
+		})
+	}
+}
+
+func newUser() *models.User {
+	id := uuid.NewString()
+	return &models.User{
+		Email:        fmt.Sprintf("%s@storagetest.test", id),
+		UUID:         id,
+		PasswordHash: "hash-" + id,
+	}
+}
+
+func newSession(userUUID string) *models.Session {
+	now := time.Now().Unix()
+	return &models.Session{
+		Id:              uuid.NewString(),
+		UUID:            userUUID,
+		Device:          "storagetest",
+		RefreshSelector: uuid.NewString(),
+		RefreshDigest:   uuid.NewString(),
+		UsedRefreshes:   []models.UsedRefresh{},
+		CreatedAt:       now,
+		LastUsedAt:      now,
+		ExpiresAt:       now + 3600,
+	}
+}
+
+// rotate moves current refresh token of the session to used ones, like the service does.
+func rotate(session *models.Session) {
+	session.UsedRefreshes = append(session.UsedRefreshes, models.UsedRefresh{
+		Selector: session.RefreshSelector,
+		Digest:   session.RefreshDigest,
+	})
+	session.RefreshSelector = uuid.NewString()
+	session.RefreshDigest = uuid.NewString()
+	session.Generation++
+}
+
+func requireSameSession(t *testing.T, expected, actual *models.Session) {
+	t.Helper()
+	require.NotNil(t, actual)
+	assert.Equal(t, expected.Id, actual.Id)
+	assert.Equal(t, expected.UUID, actual.UUID)
+	assert.Equal(t, expected.Device, actual.Device)
+	assert.Equal(t, expected.RefreshSelector, actual.RefreshSelector)
+	assert.Equal(t, expected.RefreshDigest, actual.RefreshDigest)
+	assert.Equal(t, expected.Generation, actual.Generation)
+	assert.Equal(t, expected.UsedRefreshes, actual.UsedRefreshes, "used refresh tokens must keep their order")
+	assert.Equal(t, expected.CreatedAt, actual.CreatedAt)
+	assert.Equal(t, expected.LastUsedAt, actual.LastUsedAt)
+	assert.Equal(t, expected.ExpiresAt, actual.ExpiresAt)
+	assert.Equal(t, expected.RevokedAt, actual.RevokedAt)
+}
+
+var userCases = []testCase{
+	{"create and lookup", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		byUUID, err := repo.GetUserByUUID(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, user.Email, byUUID.Email)
+		assert.Equal(t, user.PasswordHash, byUUID.PasswordHash)
+		byEmail, err := repo.GetUserByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, user.UUID, byEmail.UUID)
+	}},
+	{"duplicate email", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		other := newUser()
+		other.Email = user.Email
+		assert.ErrorIs(t, repo.SaveUser(ctx, other), storage.ErrUserExist)
+	}},
+	{"duplicate uuid", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		other := newUser()
+		other.UUID = user.UUID
+		assert.ErrorIs(t, repo.SaveUser(ctx, other), storage.ErrUserExist)
+	}},
+	{"missing user", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		_, err := repo.GetUserByUUID(ctx, user.UUID)
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+		_, err = repo.GetUserByEmail(ctx, user.Email)
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+		assert.ErrorIs(t, repo.UpdatePasswordHash(ctx, user.UUID, "hash"), storage.ErrUserNotFound)
+	}},
+	{"update password hash", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		require.NoError(t, repo.UpdatePasswordHash(ctx, user.UUID, "new-hash"))
+		found, err := repo.GetUserByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, "new-hash", found.PasswordHash)
+	}},
+	{"failed attempts and lock", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		for expected := 1; expected <= 3; expected++ {
+			attempts, err := repo.RecordFailedAttempt(ctx, user.UUID, int64(100+expected), 0)
+			require.NoError(t, err)
+			assert.Equal(t, expected, attempts)
+		}
+		require.NoError(t, repo.LockUser(ctx, user.UUID, 500))
+		require.NoError(t, repo.LockUser(ctx, user.UUID, 200), "lock must not be shortened")
+		found, err := repo.GetUserByUUID(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, found.FailedAttempts)
+		assert.Equal(t, int64(103), found.LastFailedAt)
+		assert.Equal(t, int64(500), found.LockedUntil)
+		assert.Equal(t, user.PasswordHash, found.PasswordHash)
+
+		attempts, err := repo.RecordFailedAttempt(ctx, user.UUID, 300, 200)
+		require.NoError(t, err)
+		assert.Equal(t, 1, attempts, "attempts before notBefore must be forgotten")
+
+		require.NoError(t, repo.ResetFailedAttempts(ctx, user.UUID))
+		found, err = repo.GetUserByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Zero(t, found.FailedAttempts)
+		assert.Zero(t, found.LastFailedAt)
+		assert.Zero(t, found.LockedUntil)
+	}},
+	{"failed attempts of missing user", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		_, err := repo.RecordFailedAttempt(ctx, user.UUID, 1, 0)
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+		assert.ErrorIs(t, repo.LockUser(ctx, user.UUID, 1), storage.ErrUserNotFound)
+		assert.ErrorIs(t, repo.ResetFailedAttempts(ctx, user.UUID), storage.ErrUserNotFound)
+	}},
+	{"concurrent failed attempts", func(t *testing.T, ctx context.Context, repo Repo) {
+		user := newUser()
+		require.NoError(t, repo.SaveUser(ctx, user))
+		wg := sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.RecordFailedAttempt(ctx, user.UUID, 100, 0)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		found, err := repo.GetUserByUUID(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, concurrency, found.FailedAttempts, "increments must not be lost")
+	}},
+}
+
+var sessionCases = []testCase{
+	{"save and get", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		found, err := repo.GetSession(ctx, session.Id)
+		require.NoError(t, err)
+		requireSameSession(t, session, found)
+		found, err = repo.GetSessionBySelector(ctx, session.RefreshSelector)
+		require.NoError(t, err)
+		requireSameSession(t, session, found)
+	}},
+	{"duplicate id", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		other := newSession(session.UUID)
+		other.Id = session.Id
+		assert.ErrorIs(t, repo.SaveSession(ctx, other), storage.ErrSessionExist)
+	}},
+	{"missing session", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		_, err := repo.GetSession(ctx, session.Id)
+		assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+		_, err = repo.GetSessionBySelector(ctx, session.RefreshSelector)
+		assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+		assert.ErrorIs(t, repo.UpdateSession(ctx, session, session.Generation), storage.ErrSessionNotFound)
+		assert.ErrorIs(t, repo.RevokeSession(ctx, session.Id), storage.ErrSessionNotFound)
+	}},
+	{"overwrite refresh", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		first := session.RefreshSelector
+		rotate(session)
+		session.LastUsedAt++
+		session.ExpiresAt++
+		require.NoError(t, repo.UpdateSession(ctx, session, session.Generation-1))
+		for _, selector := range []string{first, session.RefreshSelector} {
+			found, err := repo.GetSessionBySelector(ctx, selector)
+			require.NoError(t, err)
+			requireSameSession(t, session, found)
+		}
+	}},
+	{"forgotten refresh", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		first := session.RefreshSelector
+		rotate(session)
+		session.UsedRefreshes = []models.UsedRefresh{}
+		require.NoError(t, repo.UpdateSession(ctx, session, session.Generation-1))
+		_, err := repo.GetSessionBySelector(ctx, first)
+		assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+	}},
+	{"stale generation", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		rotate(session)
+		require.NoError(t, repo.UpdateSession(ctx, session, session.Generation-1))
+		stale := *session
+		rotate(&stale)
+		assert.ErrorIs(t, repo.UpdateSession(ctx, &stale, session.Generation-1), storage.ErrSessionConflict)
+		found, err := repo.GetSession(ctx, session.Id)
+		require.NoError(t, err)
+		requireSameSession(t, session, found)
+	}},
+	{"update revoked", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		require.NoError(t, repo.RevokeSession(ctx, session.Id))
+		rotate(session)
+		assert.ErrorIs(t, repo.UpdateSession(ctx, session, session.Generation-1), storage.ErrSessionConflict)
+	}},
+	{"revoke session", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		require.NoError(t, repo.RevokeSession(ctx, session.Id))
+		found, err := repo.GetSession(ctx, session.Id)
+		require.NoError(t, err)
+		assert.NotZero(t, found.RevokedAt)
+	}},
+	{"revoke user sessions", func(t *testing.T, ctx context.Context, repo Repo) {
+		userUUID := uuid.NewString()
+		active, revoked, foreign := newSession(userUUID), newSession(userUUID), newSession(uuid.NewString())
+		revoked.RevokedAt = 1
+		for _, session := range []*models.Session{active, revoked, foreign} {
+			require.NoError(t, repo.SaveSession(ctx, session))
+		}
+		require.NoError(t, repo.RevokeUserSessions(ctx, userUUID))
+		found, err := repo.GetSession(ctx, active.Id)
+		require.NoError(t, err)
+		assert.NotZero(t, found.RevokedAt)
+		found, err = repo.GetSession(ctx, revoked.Id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), found.RevokedAt, "revocation time must not be overwritten")
+		found, err = repo.GetSession(ctx, foreign.Id)
+		require.NoError(t, err)
+		assert.Zero(t, found.RevokedAt)
+	}},
+	{"expiry is kept", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		session.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+		require.NoError(t, repo.SaveSession(ctx, session))
+		found, err := repo.GetSessionBySelector(ctx, session.RefreshSelector)
+		require.NoError(t, err, "expired sessions are checked by the service, not hidden by storage")
+		assert.Equal(t, session.ExpiresAt, found.ExpiresAt)
+	}},
+}
+
+func denylistOf(t *testing.T, repo Repo) service.TokenDenylist {
+	denylist, ok := repo.(service.TokenDenylist)
+	if !ok {
+		t.Skip("repo does not implement denylist")
+	}
+	return denylist
+}
+
+var denylistCases = []testCase{
+	{"denied until expiry", func(t *testing.T, ctx context.Context, repo Repo) {
+		denylist := denylistOf(t, repo)
+		active, expired, unknown := uuid.NewString(), uuid.NewString(), uuid.NewString()
+		require.NoError(t, denylist.Deny(ctx, active, time.Now().Add(time.Hour)))
+		require.NoError(t, denylist.Deny(ctx, expired, time.Now().Add(-time.Second)))
+		for jti, expected := range map[string]bool{active: true, expired: false, unknown: false} {
+			denied, err := denylist.IsDenied(ctx, jti)
+			require.NoError(t, err)
+			assert.Equal(t, expected, denied, jti)
+		}
+	}},
+	{"deny again", func(t *testing.T, ctx context.Context, repo Repo) {
+		denylist := denylistOf(t, repo)
+		jti := uuid.NewString()
+		require.NoError(t, denylist.Deny(ctx, jti, time.Now().Add(-time.Second)))
+		require.NoError(t, denylist.Deny(ctx, jti, time.Now().Add(time.Hour)))
+		denied, err := denylist.IsDenied(ctx, jti)
+		require.NoError(t, err)
+		assert.True(t, denied)
+	}},
+}
+
+var concurrencyCases = []testCase{
+	{"same email", func(t *testing.T, ctx context.Context, repo Repo) {
+		email := newUser().Email
+		errs := make(chan error, concurrency)
+		wg := sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := newUser()
+				user.Email = email
+				errs <- repo.SaveUser(ctx, user)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		saved := 0
+		for err := range errs {
+			if err == nil {
+				saved++
+				continue
+			}
+			assert.ErrorIs(t, err, storage.ErrUserExist)
+		}
+		assert.Equal(t, 1, saved)
+	}},
+	{"one rotation wins", func(t *testing.T, ctx context.Context, repo Repo) {
+		session := newSession(uuid.NewString())
+		require.NoError(t, repo.SaveSession(ctx, session))
+		errs := make(chan error, concurrency)
+		wg := sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			rotated := *session
+			rotate(&rotated)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- repo.UpdateSession(ctx, &rotated, session.Generation)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		rotated := 0
+		for err := range errs {
+			if err == nil {
+				rotated++
+				continue
+			}
+			assert.ErrorIs(t, err, storage.ErrSessionConflict)
+		}
+		assert.Equal(t, 1, rotated)
+	}},
+	{"sessions of one user", func(t *testing.T, ctx context.Context, repo Repo) {
+		userUUID := uuid.NewString()
+		sessions := make([]*models.Session, concurrency)
+		wg := sync.WaitGroup{}
+		for i := range sessions {
+			sessions[i] = newSession(userUUID)
+			wg.Add(1)
+			go func(session *models.Session) {
+				defer wg.Done()
+				assert.NoError(t, repo.SaveSession(ctx, session))
+				assert.NoError(t, repo.RevokeSession(ctx, session.Id))
+			}(sessions[i])
+		}
+		wg.Wait()
+		for _, session := range sessions {
+			found, err := repo.GetSessionBySelector(ctx, session.RefreshSelector)
+			require.NoError(t, err)
+			assert.NotZero(t, found.RevokedAt)
+		}
+	}},
+}
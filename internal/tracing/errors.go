@@ -0,0 +1,8 @@
+package tracing
+
+import "errors"
+
+var (
+	ErrUnknownExporter = errors.New("unknown trace exporter")
+	ErrEmptyFilePath   = errors.New("trace file path cant be empty")
+)
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EwvwGeN/medods_assignment/internal/config"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) Test_SetupFileExporter(){
+	path := filepath.Join(suite.T().TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), config.TracingConfig{
+		Exporter: "file",
+		FilePath: path,
+	})
+	suite.Require().NoError(err)
+	_, span := otel.Tracer("test").Start(context.Background(), "test.span")
+	span.End()
+	suite.Require().NoError(shutdown(context.Background()))
+
+	written, err := os.ReadFile(path)
+	suite.Require().NoError(err)
+	suite.Contains(string(written), `"Name":"test.span"`)
+	suite.Contains(string(written), `"Value":"auth_service"`)
+}
+
+func (suite *testSuite) Test_SetupErrors(){
+	_, err := Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"})
+	suite.ErrorIs(err, ErrUnknownExporter)
+	_, err = Setup(context.Background(), config.TracingConfig{Exporter: "file"})
+	suite.ErrorIs(err, ErrEmptyFilePath)
+}
+
+func (suite *testSuite) Test_End(){
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	failed := errors.New("failed")
+	_, span := tracer.Start(context.Background(), "failed")
+	End(span, &failed)
+	var ok error
+	_, span = tracer.Start(context.Background(), "ok")
+	End(span, &ok)
+
+	ended := spans.Ended()
+	suite.Require().Len(ended, 2)
+	suite.Equal(codes.Error, ended[0].Status().Code)
+	suite.Equal("failed", ended[0].Status().Description)
+	suite.Len(ended[0].Events(), 1)
+	suite.Equal(codes.Unset, ended[1].Status().Code)
+}
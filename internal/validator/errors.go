@@ -0,0 +1,9 @@
+package validator
+
+import "errors"
+
+var (
+	ErrEmailSyntax = errors.New("must be valid email address")
+	ErrEmailLength = errors.New("email address is too long")
+	ErrEmailDomain = errors.New("email domain is invalid")
+)
@@ -0,0 +1,118 @@
+// Package validator checks and normalizes fields of requests.
+package validator
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// Limits are described in RFC 5321.
+	maxEmailLength      = 254
+	maxEmailLocalLength = 64
+)
+
+// FieldError describes why the field is invalid.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors is returned when some fields are invalid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Validator collects errors of all fields, so the client gets them at once.
+// Zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+func (v *Validator) Add(field, message string) {
+	v.errs = append(v.errs, FieldError{
+		Field: field,
+		Message: message,
+	})
+}
+
+func (v *Validator) Required(field, value string) bool {
+	if value == "" {
+		v.Add(field, "must not be empty")
+		return false
+	}
+	return true
+}
+
+// MaxLength checks length in bytes, so it also limits work done with the value.
+func (v *Validator) MaxLength(field, value string, max int) bool {
+	if len(value) > max {
+		v.Add(field, "must not be longer than "+strconv.Itoa(max)+" bytes")
+		return false
+	}
+	return true
+}
+
+// Email checks the address and replaces it with normalized one.
+func (v *Validator) Email(field string, email *string) bool {
+	if !v.Required(field, *email) {
+		return false
+	}
+	normalized, err := NormalizeEmail(*email)
+	if err != nil {
+		v.Add(field, err.Error())
+		return false
+	}
+	*email = normalized
+	return true
+}
+
+// Err returns Errors if any field is invalid.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// NormalizeEmail checks syntax of the address and returns it case folded
+// with the domain converted to punycode, so differently written addresses
+// of the same mailbox are equal when uniqueness is checked.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if !utf8.ValidString(email) {
+		return "", ErrEmailSyntax
+	}
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrEmailSyntax
+	}
+	local, domain := email[:at], email[at+1:]
+	if len(local) > maxEmailLocalLength {
+		return "", ErrEmailLength
+	}
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", ErrEmailDomain
+	}
+	normalized := strings.ToLower(local) + "@" + domain
+	if len(normalized) > maxEmailLength {
+		return "", ErrEmailLength
+	}
+	// display names and comments are accepted by the parser, so the result must be the address itself
+	addr, err := mail.ParseAddress(normalized)
+	if err != nil || addr.Address != normalized {
+		return "", ErrEmailSyntax
+	}
+	return normalized, nil
+}
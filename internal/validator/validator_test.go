@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+}
+
+func TestSuiteRun(t *testing.T) {
+	suite.Run(t, new(testSuite))
+}
+
+func (suite *testSuite) Test_NormalizeEmail(){
+	valid := map[string]string{
+		"Test@Test.Test": "test@test.test",
+		" user.name+tag@example.com ": "user.name+tag@example.com",
+		"user@Bücher.example": "user@xn--bcher-kva.example",
+		"user@xn--bcher-kva.example": "user@xn--bcher-kva.example",
+	}
+	for email, expected := range valid {
+		normalized, err := NormalizeEmail(email)
+		suite.NoError(err, email)
+		suite.Equal(expected, normalized, email)
+	}
+	invalid := map[string]error{
+		"": ErrEmailSyntax,
+		"user": ErrEmailSyntax,
+		"@example.com": ErrEmailSyntax,
+		"user@": ErrEmailSyntax,
+		"user@localhost": ErrEmailDomain,
+		"user@exa mple.com": ErrEmailDomain,
+		"Name <user@example.com>": ErrEmailDomain,
+		"us er@example.com": ErrEmailSyntax,
+		strings.Repeat("a", 65) + "@example.com": ErrEmailLength,
+		"user@" + strings.Repeat("a.", 125) + "com": ErrEmailLength,
+	}
+	for email, expected := range invalid {
+		_, err := NormalizeEmail(email)
+		suite.ErrorIs(err, expected, email)
+	}
+}
+
+func (suite *testSuite) Test_CollectsAllErrors(){
+	email := "Test@Test.Test"
+	v := Validator{}
+	v.Email("email", &email)
+	v.Required("password", "")
+	v.MaxLength("device", "laptop", 3)
+	err := v.Err()
+	suite.Equal("test@test.test", email)
+	suite.Equal(Errors{
+		{Field: "password", Message: "must not be empty"},
+		{Field: "device", Message: "must not be longer than 3 bytes"},
+	}, err)
+
+	suite.NoError((&Validator{}).Err())
+}